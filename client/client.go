@@ -0,0 +1,434 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"kamaRPC/codec"
+	"kamaRPC/internal/breaker"
+	"kamaRPC/internal/limiter"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/internal/transport"
+	"kamaRPC/loadbalance"
+	"kamaRPC/metadata"
+	"kamaRPC/registry"
+	"kamaRPC/status"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Future 异步调用的结果句柄，由 InvokeAsync 返回
+type Future = transport.Future
+
+// Stream 流式调用返回的流，可以多次 Send/Recv
+type Stream = transport.Stream
+
+// Dialer 建立到服务端的底层连接，用 WithClientDialer 替换默认的 TCP/unix/mem 拨号方式
+type Dialer = transport.Dialer
+
+type Client struct {
+	reg     *registry.Registry
+	lb      loadbalance.LoadBalancer
+	limiter *limiter.TokenBucket
+	timeout time.Duration
+	codec   codec.Codec
+	// 握手时声明并写入每个请求的 codec 类型
+	codecType codec.Type
+	// 服务端发来的帧的大小限制
+	limits protocol.Limits
+	// 是否请求对每一帧做 CRC32 校验
+	checksum bool
+	// 默认的压缩算法，以及不压缩的 body 大小上限
+	compression codec.CompressionType
+	compressMin int
+	// 校验和不一致而关闭的连接数
+	checksumErrors atomic.Uint64
+	// 不为 nil 时使用 TLS 连接服务端
+	tlsConfig *tls.Config
+	// 建立底层连接的方式，为 nil 时按地址的类型拨号
+	dialer  Dialer
+	breaker sync.Map // map[string]*CircuitBreaker
+
+	pools sync.Map // map[string]*transport.ConnectionPool
+
+	// 直接连接的实例，设置后不经过注册中心做服务发现
+	instances []registry.Instance
+	// 心跳、读超时和空闲连接关闭的参数
+	keepalive transport.KeepaliveParams
+}
+
+func NewClient(reg *registry.Registry, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		reg:     reg,
+		lb:      &loadbalance.RoundRobin{},
+		limiter: limiter.NewTokenBucket(10000),
+		timeout: 5 * time.Second,
+
+		compression: codec.CompressionGzip,
+		compressMin: codec.DefaultCompressMinSize,
+		keepalive: transport.KeepaliveParams{
+			Interval: transport.DefaultKeepaliveInterval,
+			Timeout:  transport.DefaultKeepaliveTimeout,
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.codec == nil {
+		if err := WithClientCodec(codec.JSON)(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) InvokeAsync(ctx context.Context, service string, method string, args interface{}, opts ...CallOption) (*Future, error) {
+	o := c.newCallOptions(opts)
+
+	cc, err := c.callCodec(o)
+	if err != nil {
+		return nil, err
+	}
+	body, err := cc.Marshal(args)
+	if err != nil {
+		return nil, status.Wrap(status.Internal, err)
+	}
+
+	return c.invokeBody(ctx, service, method, body, o)
+}
+
+// InvokeRaw 发送已经序列化好的请求 body，返回服务端编码好的响应 body，
+// 调用方不需要知道请求和响应的具体类型，适合实现通用的转发和回放工具。
+//
+// body 按客户端的 codec 声明，可以用 WithCallCodec 声明为其他 codec，
+// 服务端按声明的 codec 解码请求并用同一个 codec 编码响应
+func (c *Client) InvokeRaw(ctx context.Context, service string, method string, body []byte, opts ...CallOption) ([]byte, error) {
+	o := c.newCallOptions(opts)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	future, err := c.invokeBody(ctx, service, method, body, o)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := future.WaitWithContext(ctx)
+
+	if o.trailer != nil {
+		*o.trailer = future.Trailer()
+	}
+	return reply, err
+}
+
+// invokeBody 发送已经编码好的请求
+func (c *Client) invokeBody(ctx context.Context, service string, method string, body []byte, o *callOptions) (*Future, error) {
+
+	// 调用方 ctx 被取消时通知服务端取消请求
+	callerCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, br, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	// 截止时间取调用方 ctx 和客户端超时中较早的一个，
+	// 在取到连接之后计算，拨号和握手的耗时不算进服务端的超时
+	req, err := newRequest(ctx, service, method, body, o)
+	if err != nil {
+		br.RecordIgnored()
+		return nil, err
+	}
+
+	future, err := conn.SendAsync(callerCtx, req)
+	if err != nil {
+		br.RecordFailure()
+		return nil, err
+	}
+
+	// 调用方主动取消与服务端的健康状况无关，不计入熔断统计
+	future.OnComplete(func(err error) {
+		switch {
+		case err == nil:
+			br.RecordSuccess()
+		case status.CodeOf(err) == status.Canceled:
+			br.RecordIgnored()
+		default:
+			br.RecordFailure()
+		}
+	})
+
+	return future, nil
+}
+
+// 同步接口 = 异步 + 等待
+func (c *Client) Invoke(ctx context.Context, service string, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+
+	// 等待结果的截止时间与发给服务端的保持一致
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	future, err := c.InvokeAsync(ctx, service, method, args, opts...)
+	if err != nil {
+		return err
+	}
+
+	err = future.GetResultWithContext(ctx, reply)
+
+	if o := c.newCallOptions(opts); o.trailer != nil {
+		*o.trailer = future.Trailer()
+	}
+	return err
+}
+
+// NewStream 打开一个流式调用，服务端方法签名为 func(stream *server.Stream) error
+//
+// 发送完毕后调用 CloseSend，Recv 返回 io.EOF 表示服务端正常结束，
+// ctx 被取消或调用 Close 会通知服务端放弃这次调用
+func (c *Client) NewStream(ctx context.Context, service string, method string, opts ...CallOption) (*Stream, error) {
+	o := c.newCallOptions(opts)
+
+	cc, err := c.callCodec(o)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, br, err := c.connect(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	// 流一般是长连接，只在调用方设置了截止时间时才传给服务端
+	req, err := newRequest(ctx, service, method, nil, o)
+	if err != nil {
+		br.RecordIgnored()
+		return nil, err
+	}
+
+	stream, err := conn.OpenStream(ctx, req, cc)
+	if err != nil {
+		br.RecordFailure()
+		return nil, err
+	}
+	br.RecordSuccess()
+
+	return stream, nil
+}
+
+// Notify 单向调用，请求写出后立即返回，服务端执行方法但不回复响应，
+// 因此拿不到方法的返回值和错误
+func (c *Client) Notify(ctx context.Context, service string, method string, args interface{}, opts ...CallOption) error {
+	o := c.newCallOptions(opts)
+
+	cc, err := c.callCodec(o)
+	if err != nil {
+		return err
+	}
+
+	body, err := cc.Marshal(args)
+	if err != nil {
+		return status.Wrap(status.Internal, err)
+	}
+
+	conn, br, err := c.connect(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	// 服务端会丢弃已经超时的单向请求
+	req, err := newRequest(ctx, service, method, body, o)
+	if err != nil {
+		br.RecordIgnored()
+		return err
+	}
+
+	if err := conn.Send(req); err != nil {
+		br.RecordFailure()
+		return err
+	}
+	br.RecordSuccess()
+	return nil
+}
+
+// newRequest 构造请求帧，附带 ctx 中的元数据。ctx 有截止时间时把剩余时间随请求发给服务端，
+// ctx 已经结束时返回对应的错误
+func newRequest(ctx context.Context, service string, method string, body []byte, o *callOptions) (*protocol.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err)
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	req := &protocol.Message{
+		Header: &protocol.Header{
+			ServiceName: service,
+			MethodName:  method,
+			CodecType:   o.codecType,
+			Compression: o.compression,
+			Metadata:    md,
+		},
+		Body: body,
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Timeout = time.Until(deadline)
+		if req.Header.Timeout <= 0 {
+			return nil, status.New(status.DeadlineExceeded, "deadline exceeded before sending")
+		}
+	}
+	return req, nil
+}
+
+// callCodec 返回本次调用使用的 codec
+func (c *Client) callCodec(o *callOptions) (codec.Codec, error) {
+	if o.codecType == c.codecType {
+		return c.codec, nil
+	}
+	cc, err := codec.New(o.codecType)
+	if err != nil {
+		return nil, status.Wrap(status.InvalidArgument, err)
+	}
+	return cc, nil
+}
+
+// connect 经过限流、服务发现和熔断检查后，从连接池中取出一条到目标实例的连接。
+// 返回的连接上的调用结束后必须向熔断器记录结果（与服务端无关的失败用 RecordIgnored），
+// 否则半开状态的探测会一直占用
+func (c *Client) connect(ctx context.Context, service string) (*transport.TCPClient, *breaker.CircuitBreaker, error) {
+
+	if !c.limiter.Allow() {
+		return nil, nil, status.New(status.ResourceExhausted, "rate limit exceeded")
+	}
+
+	addr, err := c.getAddr(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := c.getBreaker(service, addr)
+
+	if !br.Allow() {
+		return nil, nil, status.New(status.Unavailable, "circuit breaker open")
+	}
+
+	pool := c.getPool(service, addr)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		br.RecordFailure()
+		return nil, nil, status.Wrap(status.Unavailable, err)
+	}
+	return conn, br, nil
+}
+
+// getPool 返回到 addr 的连接池，连接池按地址共享，service 只用于建连时的握手
+func (c *Client) getPool(service, addr string) *transport.ConnectionPool {
+	if pool, ok := c.pools.Load(addr); ok {
+		return pool.(*transport.ConnectionPool)
+	}
+
+	dialer := c.dialer
+	if c.tlsConfig != nil {
+		dialer = &transport.TLSDialer{Dialer: c.dialer, Config: c.tlsConfig}
+	}
+
+	newPool := transport.NewConnectionPool(addr, 0, 1, transport.Options{
+		Service:         service,
+		Codecs:          []codec.Type{c.codecType},
+		Compressions:    c.compressions(),
+		CompressMinSize: c.compressMin,
+		Limits:          c.limits,
+		Checksum:        c.checksum,
+		OnFrameError:    c.onFrameError,
+		Dialer:          dialer,
+		Keepalive:       c.keepalive,
+	})
+	actual, _ := c.pools.LoadOrStore(addr, newPool)
+	return actual.(*transport.ConnectionPool)
+}
+
+// onFrameError 连接因为收到非法帧被关闭
+func (c *Client) onFrameError(err error) {
+	if errors.Is(err, protocol.ErrChecksumMismatch) {
+		c.checksumErrors.Add(1)
+	}
+	log.Println("close connection on bad frame:", err)
+}
+
+// ChecksumErrors 返回因为校验和不一致而关闭的连接数
+func (c *Client) ChecksumErrors() uint64 {
+	return c.checksumErrors.Load()
+}
+
+// compressions 握手时声明的压缩算法，默认的压缩算法排在最前，
+// 服务端在请求没有压缩时按这个顺序选择响应的压缩算法
+func (c *Client) compressions() []codec.CompressionType {
+	types := codec.Compressions()
+	if c.compression == codec.CompressionNone {
+		return types
+	}
+	types = slices.DeleteFunc(types, func(t codec.CompressionType) bool {
+		return t == c.compression
+	})
+	return append([]codec.CompressionType{c.compression}, types...)
+}
+
+func (c *Client) getAddr(service string) (string, error) {
+	instances := c.instances
+	if len(instances) == 0 {
+		if c.reg == nil {
+			return "", status.New(status.FailedPrecondition, "registry not configured")
+		}
+
+		var err error
+		instances, err = c.reg.Discover(service)
+		if err != nil {
+			return "", status.Wrap(status.Unavailable, err)
+		}
+	}
+
+	if len(instances) == 0 {
+		return "", status.New(status.Unavailable, "no instance available")
+	}
+
+	instance := c.lb.Select(instances)
+	log.Println("选择的地址为:", instance.Addr)
+	return instance.Addr, nil
+}
+
+func (c *Client) Close() {
+	c.pools.Range(func(key, value interface{}) bool {
+		pool := value.(*transport.ConnectionPool)
+		pool.Close()
+		return true
+	})
+}
+
+func (c *Client) getBreaker(service, addr string) *breaker.CircuitBreaker {
+
+	key := service + "|" + addr
+
+	if val, ok := c.breaker.Load(key); ok {
+		return val.(*breaker.CircuitBreaker)
+	}
+
+	newBreaker := breaker.NewCircuitBreaker(
+		10,
+		0.6,           // 60% 错误率熔断
+		5*time.Second, // 熔断 5 秒
+	)
+
+	actual, _ := c.breaker.LoadOrStore(key, newBreaker)
+
+	return actual.(*breaker.CircuitBreaker)
+}
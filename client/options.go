@@ -0,0 +1,241 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/loadbalance"
+	"kamaRPC/metadata"
+	"kamaRPC/registry"
+	"time"
+)
+
+type ClientOption func(*Client) error
+
+func WithClientCodec(t codec.Type) ClientOption {
+	return func(c *Client) error {
+		cc, err := codec.New(t)
+		if err != nil {
+			return err
+		}
+		c.codec = cc
+		c.codecType = t
+		return nil
+	}
+}
+
+// WithClientAddrs 所有服务都直接连接 addrs 中的实例，按负载均衡策略选择，不经过注册中心。
+// 地址可以是 host:port、unix:///path 或 mem://name，NewClient 的 registry 可以传 nil
+func WithClientAddrs(addrs ...string) ClientOption {
+	return func(c *Client) error {
+		if len(addrs) == 0 {
+			return fmt.Errorf("addrs must not be empty")
+		}
+		c.instances = c.instances[:0]
+		for _, addr := range addrs {
+			c.instances = append(c.instances, registry.Instance{Addr: addr})
+		}
+		return nil
+	}
+}
+
+func WithClientTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithClientMaxHeaderSize 限制服务端发来的帧的 header 大小，超过时关闭连接
+func WithClientMaxHeaderSize(n int) ClientOption {
+	return func(c *Client) error {
+		if n <= 0 || n > protocol.MaxHeaderLen {
+			return fmt.Errorf("max header size must be in (0, %d]", protocol.MaxHeaderLen)
+		}
+		c.limits.MaxHeaderSize = n
+		return nil
+	}
+}
+
+// WithClientMaxBodySize 限制服务端发来的帧的 body 大小（压缩前后都不能超过），超过时关闭连接
+func WithClientMaxBodySize(n int) ClientOption {
+	return func(c *Client) error {
+		if n <= 0 {
+			return fmt.Errorf("max body size must be positive")
+		}
+		c.limits.MaxBodySize = n
+		return nil
+	}
+}
+
+// WithClientCompression 设置默认的压缩算法，CompressionNone 表示不压缩，
+// 服务端不支持时退化为不压缩
+func WithClientCompression(t codec.CompressionType) ClientOption {
+	return func(c *Client) error {
+		if t != codec.CompressionNone && codec.GetCompressor(t) == nil {
+			return fmt.Errorf("compression type %d not registered", t)
+		}
+		c.compression = t
+		return nil
+	}
+}
+
+// WithClientCompressMinSize 只压缩不小于 n 字节的 body，0 表示总是压缩，
+// 默认为 codec.DefaultCompressMinSize
+func WithClientCompressMinSize(n int) ClientOption {
+	return func(c *Client) error {
+		if n < 0 {
+			return fmt.Errorf("compress min size must not be negative")
+		}
+		c.compressMin = n
+		return nil
+	}
+}
+
+// WithClientChecksum 请求对连接上的每一帧做 CRC32 校验，服务端不支持时不启用。
+// 校验失败的连接会被关闭，次数可以通过 Client.ChecksumErrors 查看
+func WithClientChecksum() ClientOption {
+	return func(c *Client) error {
+		c.checksum = true
+		return nil
+	}
+}
+
+func WithClientLoadBalancer(lb loadbalance.LoadBalancer) ClientOption {
+	return func(c *Client) error {
+		c.lb = lb
+		return nil
+	}
+}
+
+// CallOption 单次调用的参数
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	trailer     *metadata.MD
+	compression codec.CompressionType
+	codecType   codec.Type
+}
+
+func (c *Client) newCallOptions(opts []CallOption) *callOptions {
+	o := &callOptions{compression: c.compression, codecType: c.codecType}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCallTrailer 调用完成后把服务端返回的元数据写入 md，只对 Invoke 和 InvokeRaw 生效
+func WithCallTrailer(md *metadata.MD) CallOption {
+	return func(o *callOptions) {
+		o.trailer = md
+	}
+}
+
+// WithCallCompression 本次调用使用的压缩算法，覆盖 WithClientCompression 的设置，
+// body 小于压缩阈值时仍然不压缩
+func WithCallCompression(t codec.CompressionType) CallOption {
+	return func(o *callOptions) {
+		o.compression = t
+	}
+}
+
+// WithCallCodec 本次调用使用的 codec，覆盖 WithClientCodec 的设置。
+// 对 InvokeRaw 只是声明 body 的编码方式，服务端用它解码请求、编码响应
+func WithCallCodec(t codec.Type) CallOption {
+	return func(o *callOptions) {
+		o.codecType = t
+	}
+}
+
+// WithClientKeepalive 连接超过 interval 没有收到任何帧时发送心跳，超过 timeout 没有收到任何帧时
+// 认为服务端已经失联并关闭连接，等待中的请求以 Unavailable 失败，下次调用时重新建连。
+// 只对握手时声明支持心跳的服务端生效，0 表示不开启对应的功能，默认为 30 秒和 90 秒
+func WithClientKeepalive(interval, timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		p := c.keepalive
+		p.Interval = interval
+		p.Timeout = timeout
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		c.keepalive = p
+		return nil
+	}
+}
+
+// WithClientIdleTimeout 关闭超过 d 没有进行中请求和流的连接，下次调用时重新建连，0 表示不关闭（默认）
+func WithClientIdleTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		p := c.keepalive
+		p.IdleTimeout = d
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		c.keepalive = p
+		return nil
+	}
+}
+
+// WithClientDialer 使用 d 建立到服务端的底层连接，用于接入新的承载方式。
+// 同时设置了 TLS 时在 d 建立的连接上再做 TLS 握手
+func WithClientDialer(d Dialer) ClientOption {
+	return func(c *Client) error {
+		if d == nil {
+			return fmt.Errorf("dialer must not be nil")
+		}
+		c.dialer = d
+		return nil
+	}
+}
+
+// WithClientRootCAs 使用 TLS 连接服务端，并用 pool 中的 CA 校验服务端证书
+func WithClientRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *Client) error {
+		if pool == nil {
+			return fmt.Errorf("root CA pool must not be nil")
+		}
+		c.tls().RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificate 使用 TLS 连接服务端，并在服务端要求时出示 cert（双向 TLS）。
+// 没有设置 WithClientRootCAs 时使用系统的根证书校验服务端
+func WithClientCertificate(cert tls.Certificate) ClientOption {
+	return func(c *Client) error {
+		cfg := c.tls()
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	}
+}
+
+// WithClientServerName 使用 TLS 连接服务端，并用 name 而不是地址中的主机名校验服务端证书，
+// 通过 IP 或 unix 域套接字连接时需要设置
+func WithClientServerName(name string) ClientOption {
+	return func(c *Client) error {
+		c.tls().ServerName = name
+		return nil
+	}
+}
+
+// WithClientTLSConfig 直接使用 cfg 连接服务端，用于需要完全控制 TLS 参数的场景
+func WithClientTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		if cfg == nil {
+			return fmt.Errorf("tls config must not be nil")
+		}
+		c.tlsConfig = cfg.Clone()
+		return nil
+	}
+}
+
+// tls 返回正在构造的 TLS 配置，第一次调用时创建
+func (c *Client) tls() *tls.Config {
+	if c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.tlsConfig
+}
@@ -4,11 +4,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"kamaRPC/internal/client"
-	"kamaRPC/internal/codec"
-	"kamaRPC/internal/registry"
-	"kamaRPC/internal/transport"
+	"kamaRPC/client"
+	"kamaRPC/codec"
 	"kamaRPC/pkg/api"
+	"kamaRPC/registry"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -25,7 +24,7 @@ var (
 )
 
 type callResult struct {
-	future   *transport.Future
+	future   *client.Future
 	reqStart time.Time
 }
 
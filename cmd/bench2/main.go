@@ -4,10 +4,10 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"kamaRPC/internal/client"
-	"kamaRPC/internal/codec"
-	"kamaRPC/internal/registry"
+	"kamaRPC/client"
+	"kamaRPC/codec"
 	"kamaRPC/pkg/api"
+	"kamaRPC/registry"
 	"log"
 	"sort"
 	"sync"
@@ -3,11 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
-	"kamaRPC/internal/client"
-	"kamaRPC/internal/codec"
-	"kamaRPC/internal/registry"
-	"kamaRPC/internal/transport"
+	"kamaRPC/client"
+	"kamaRPC/codec"
 	"kamaRPC/pkg/api"
+	"kamaRPC/registry"
 	"log"
 	"time"
 )
@@ -25,7 +24,7 @@ func main() {
 	}
 
 	type call struct {
-		future *transport.Future
+		future *client.Future
 		args   *api.Args
 	}
 
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kamaRPC/codec"
+	"kamaRPC/pkg/api"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 不依赖 etcd 和网络，只比较各个 codec 编解码本身的耗时和编码后的大小
+//
+// go run ./cmd/codecbench -codecs json,msgpack
+
+var codecsFlag = flag.String("codecs", "json,msgpack", "参与比较的 codec，逗号分隔，可选 json、msgpack")
+
+var codecNames = map[string]codec.Type{
+	"json":    codec.JSON,
+	"msgpack": codec.MSGPACK,
+}
+
+// Order 模拟一个字段较多的业务请求
+type Order struct {
+	ID       int64             `json:"id"`
+	User     string            `json:"user"`
+	Items    []OrderItem       `json:"items"`
+	Tags     map[string]string `json:"tags"`
+	Paid     bool              `json:"paid"`
+	Discount float64           `json:"discount"`
+}
+
+type OrderItem struct {
+	SKU   string `json:"sku"`
+	Count int    `json:"count"`
+	Price int64  `json:"price"`
+}
+
+func newOrder() *Order {
+	o := &Order{
+		ID:       1234567890,
+		User:     "user-42",
+		Tags:     map[string]string{"channel": "app", "region": "cn-east"},
+		Paid:     true,
+		Discount: 0.85,
+	}
+	for i := 0; i < 20; i++ {
+		o.Items = append(o.Items, OrderItem{SKU: fmt.Sprintf("sku-%04d", i), Count: i + 1, Price: int64(i) * 100})
+	}
+	return o
+}
+
+func main() {
+	flag.Parse()
+
+	payloads := []struct {
+		name  string
+		value interface{}
+	}{
+		{"api.Args", &api.Args{A: 12345, B: 67890}},
+		{"Order", newOrder()},
+	}
+
+	fmt.Printf("%-10s %-8s %8s %14s %14s %12s\n", "payload", "codec", "size", "marshal", "unmarshal", "allocs/op")
+
+	for _, p := range payloads {
+		for _, name := range strings.Split(*codecsFlag, ",") {
+			t, ok := codecNames[name]
+			if !ok {
+				log.Fatalf("unknown codec %q", name)
+			}
+			cc, err := codec.New(t)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			data, err := cc.Marshal(p.value)
+			if err != nil {
+				log.Fatalf("%s marshal %s: %v", name, p.name, err)
+			}
+
+			// 与 Handler.invoke 一样通过反射构造接收结果的指针
+			elem := reflect.TypeOf(p.value).Elem()
+			check := reflect.New(elem)
+			if err := cc.Unmarshal(data, check.Interface()); err != nil {
+				log.Fatalf("%s unmarshal %s: %v", name, p.name, err)
+			}
+			if !reflect.DeepEqual(check.Interface(), p.value) {
+				log.Fatalf("%s: %s does not round trip", name, p.name)
+			}
+
+			marshal := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := cc.Marshal(p.value); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			unmarshal := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := cc.Unmarshal(data, reflect.New(elem).Interface()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			fmt.Printf("%-10s %-8s %8d %11d ns %11d ns %12d\n", p.name, name, len(data),
+				marshal.NsPerOp(), unmarshal.NsPerOp(), marshal.AllocsPerOp()+unmarshal.AllocsPerOp())
+		}
+	}
+}
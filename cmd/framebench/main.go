@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/internal/transport"
+	"log"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 比较每帧新建 gzip 状态和缓冲区与复用它们的开销，以及两种读帧方式的分配和拷贝，
+// 所有用例都在多个 goroutine 中并发执行，读帧用例每个 goroutine 使用自己的连接
+//
+// go run ./cmd/framebench -size 4096 -p 4
+
+var (
+	size        = flag.Int("size", 4096, "body 大小（字节）")
+	parallelism = flag.Int("p", 1, "每个 CPU 上并发的 goroutine 数量")
+)
+
+// 改动之前的写法：每次都新建 gzip.Writer/Reader 和 bytes.Buffer
+func freshCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func freshDecompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// loopConn 循环返回同一段字节流的 net.Conn，用来在没有网络开销的情况下测量读帧
+type loopConn struct {
+	net.Conn
+	data []byte
+	off  int
+}
+
+func (c *loopConn) Read(p []byte) (int, error) {
+	n := copy(p, c.data[c.off:])
+	c.off = (c.off + n) % len(c.data)
+	return n, nil
+}
+
+// loopAddr loopConn 两端的地址，NewTCPConnection 会用它记录对端信息
+var loopAddr = &net.UnixAddr{Name: "loop", Net: "unix"}
+
+func (c *loopConn) Close() error                       { return nil }
+func (c *loopConn) LocalAddr() net.Addr                { return loopAddr }
+func (c *loopConn) RemoteAddr() net.Addr               { return loopAddr }
+func (c *loopConn) SetDeadline(t time.Time) error      { return nil }
+func (c *loopConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *loopConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// packetReader 改动之前的读帧方式：每次读都分配 4KB 的临时切片，追加进加锁的缓冲区，
+// 取出完整的包时再拷贝一次，然后交给 protocol.Decode
+type packetReader struct {
+	conn net.Conn
+	buf  []byte
+	lock sync.Mutex
+}
+
+func (r *packetReader) next() []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.buf) < 10 {
+		return nil
+	}
+	totalLen := protocol.FrameLen(r.buf[:10])
+	if len(r.buf) < totalLen {
+		return nil
+	}
+	packet := make([]byte, totalLen)
+	copy(packet, r.buf[:totalLen])
+	r.buf = r.buf[totalLen:]
+	return packet
+}
+
+func (r *packetReader) Read() (*protocol.Message, error) {
+	for {
+		if packet := r.next(); packet != nil {
+			return protocol.Decode(packet)
+		}
+
+		tmp := make([]byte, transport.BufferSize)
+		n, err := r.conn.Read(tmp)
+		if err != nil {
+			return nil, err
+		}
+		r.lock.Lock()
+		r.buf = append(r.buf, tmp[:n]...)
+		r.lock.Unlock()
+	}
+}
+
+// payload 生成有一定重复度的 body，接近真实业务数据的压缩率
+func payload(n int) []byte {
+	var sb strings.Builder
+	for i := 0; sb.Len() < n; i++ {
+		fmt.Fprintf(&sb, `{"id":%d,"name":"item-%d","tags":["a","b"]},`, i, i%97)
+	}
+	return []byte(sb.String()[:n])
+}
+
+func main() {
+	flag.Parse()
+
+	body := payload(*size)
+	compressed, err := codec.Compress(body, codec.CompressionGzip)
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg := &protocol.Message{
+		Header: &protocol.Header{
+			RequestID:   1,
+			ServiceName: "Arith",
+			MethodName:  "Add",
+			CodecType:   codec.JSON,
+			Compression: codec.CompressionGzip,
+		},
+		Body: body,
+	}
+
+	// 读帧用例分别测试未压缩和压缩的 body
+	plain := &protocol.Message{Header: &protocol.Header{}, Body: body}
+	*plain.Header = *msg.Header
+	plain.Header.Compression = codec.CompressionNone
+	plainFrame, err := protocol.Encode(plain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gzipFrame, err := protocol.Encode(msg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	type reader interface {
+		Read() (*protocol.Message, error)
+	}
+	readCase := func(frame []byte, newReader func(net.Conn) reader) func(pb *testing.PB) error {
+		return func(pb *testing.PB) error {
+			r := newReader(&loopConn{data: frame})
+			// TCPConnection 带有后台写协程，用完要关闭
+			if c, ok := r.(io.Closer); ok {
+				defer c.Close()
+			}
+			for pb.Next() {
+				if _, err := r.Read(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	oldReader := func(c net.Conn) reader { return &packetReader{conn: c} }
+	newReader := func(c net.Conn) reader { return transport.NewTCPConnection(c, protocol.Limits{}) }
+
+	cases := []struct {
+		name string
+		fn   func(pb *testing.PB) error
+	}{
+		{"compress/fresh", func(pb *testing.PB) error {
+			for pb.Next() {
+				if _, err := freshCompress(body); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"compress/pooled", func(pb *testing.PB) error {
+			for pb.Next() {
+				if _, err := codec.Compress(body, codec.CompressionGzip); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"decompress/fresh", func(pb *testing.PB) error {
+			for pb.Next() {
+				if _, err := freshDecompress(compressed); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"decompress/pooled", func(pb *testing.PB) error {
+			for pb.Next() {
+				if _, err := codec.Decompress(compressed, codec.CompressionGzip); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"encode/alloc", func(pb *testing.PB) error {
+			for pb.Next() {
+				if _, err := protocol.Encode(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"read/plain/packet", readCase(plainFrame, oldReader)},
+		{"read/plain/full", readCase(plainFrame, newReader)},
+		{"read/gzip/packet", readCase(gzipFrame, oldReader)},
+		{"read/gzip/full", readCase(gzipFrame, newReader)},
+		{"encode/reuse", func(pb *testing.PB) error {
+			// 与 TCPConnection.Write 一样复用同一块缓冲区
+			var buf []byte
+			for pb.Next() {
+				var err error
+				if buf, err = protocol.AppendFrame(buf[:0], msg, protocol.CurrentVersion, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	}
+
+	fmt.Printf("body=%dB gzip=%dB GOMAXPROCS=%d goroutines=%d\n",
+		len(body), len(compressed), runtime.GOMAXPROCS(0), runtime.GOMAXPROCS(0)**parallelism)
+	fmt.Printf("%-18s %12s %10s %12s %10s\n", "case", "ns/op", "MB/s", "B/op", "allocs/op")
+
+	for _, c := range cases {
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			b.SetParallelism(*parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				if err := c.fn(pb); err != nil {
+					b.Error(err)
+				}
+			})
+		})
+		mbps := float64(r.Bytes) * float64(r.N) / r.T.Seconds() / 1e6
+		fmt.Printf("%-18s %12d %10.1f %12d %10d\n", c.name, r.NsPerOp(), mbps, r.AllocedBytesPerOp(), r.AllocsPerOp())
+	}
+}
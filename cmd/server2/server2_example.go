@@ -1,10 +1,10 @@
 package main
 
 import (
-	"kamaRPC/internal/codec"
-	"kamaRPC/internal/registry"
-	"kamaRPC/internal/server"
+	"kamaRPC/codec"
 	"kamaRPC/pkg/api"
+	"kamaRPC/registry"
+	"kamaRPC/server"
 	"log"
 	"os"
 	"os/signal"
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 )
 
@@ -48,3 +49,16 @@ func New(t Type) (Codec, error) {
 
 	return f(), nil
 }
+
+// Types 返回已注册的全部 codec 类型，按类型值排序
+func Types() []Type {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	types := make([]Type, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
@@ -0,0 +1,196 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// CompressionType 压缩类型
+type CompressionType byte
+
+const (
+	CompressionNone CompressionType = iota
+	CompressionGzip
+	CompressionDeflate
+	CompressionZlib
+	// CompressionSnappy LZ 系列的快速压缩，压缩率低于 gzip，但延迟小得多
+	CompressionSnappy
+)
+
+// DefaultCompressMinSize 默认只压缩不小于该大小的 body，
+// 更小的 body 压缩后往往反而变大，还白白消耗 CPU
+const DefaultCompressMinSize = 1024
+
+// ErrTooLarge 解压后的数据超过了上限，用于防御压缩炸弹
+var ErrTooLarge = errors.New("codec: decompressed data exceeds limit")
+
+// Compressor 压缩接口，实现需要能被多个 goroutine 同时使用
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	// Decompress 解压后的数据超过 limit 时返回 ErrTooLarge，limit < 0 表示不限制，
+	// 流式格式可以用 ReadAllLimit 实现
+	Decompress(data []byte, limit int) ([]byte, error)
+}
+
+// AppendCompressor 可选接口，把压缩结果直接追加到 dst 之后，
+// 省去中间缓冲区的分配和拷贝，protocol 编码帧时优先使用
+type AppendCompressor interface {
+	AppendCompress(dst, data []byte) ([]byte, error)
+}
+
+// GzipCompressor gzip 压缩器，gzip.Writer/Reader 的内部状态有几百 KB，通过 sync.Pool 复用
+type GzipCompressor struct{}
+
+var (
+	gzipWriterPool = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	gzipReaderPool sync.Pool // *gzip.Reader
+)
+
+func (g *GzipCompressor) Compress(data []byte) ([]byte, error) {
+	return g.AppendCompress(nil, data)
+}
+
+func (g *GzipCompressor) AppendCompress(dst, data []byte) ([]byte, error) {
+	w := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(w)
+
+	// bytes.Buffer 从 dst 的末尾开始追加
+	buf := bytes.NewBuffer(dst)
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *GzipCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	r, ok := gzipReaderPool.Get().(*gzip.Reader)
+	if !ok {
+		r = new(gzip.Reader)
+	}
+	defer gzipReaderPool.Put(r)
+
+	if err := r.Reset(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return ReadAllLimit(r, limit)
+}
+
+// ReadAllLimit 最多多读 1 个字节来判断是否超过 limit，不会为超限的数据分配内存
+func ReadAllLimit(r io.Reader, limit int) ([]byte, error) {
+	if limit < 0 {
+		return io.ReadAll(r)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+var (
+	compressorMu sync.RWMutex
+	compressors  = make(map[CompressionType]Compressor)
+)
+
+// RegisterCompressor 注册压缩器，类型已被注册时返回错误，不会覆盖已有的实现
+func RegisterCompressor(t CompressionType, c Compressor) error {
+	compressorMu.Lock()
+	defer compressorMu.Unlock()
+
+	if c == nil {
+		return errors.New("codec: compressor is nil")
+	}
+	if t == CompressionNone {
+		return errors.New("codec: compression type 0 is reserved for no compression")
+	}
+	if _, exists := compressors[t]; exists {
+		return fmt.Errorf("codec: compression type %d already registered", t)
+	}
+
+	compressors[t] = c
+	return nil
+}
+
+// mustRegisterCompressor 用于包内 init 注册内置压缩器
+func mustRegisterCompressor(t CompressionType, c Compressor) {
+	if err := RegisterCompressor(t, c); err != nil {
+		panic(err)
+	}
+}
+
+// GetCompressor 获取压缩器，没有注册时返回 nil
+func GetCompressor(t CompressionType) Compressor {
+	compressorMu.RLock()
+	defer compressorMu.RUnlock()
+	return compressors[t]
+}
+
+// Compressions 返回已注册的全部压缩类型，按类型值排序
+func Compressions() []CompressionType {
+	compressorMu.RLock()
+	defer compressorMu.RUnlock()
+
+	types := make([]CompressionType, 0, len(compressors))
+	for t := range compressors {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+func init() {
+	mustRegisterCompressor(CompressionGzip, &GzipCompressor{})
+}
+
+// Compress 使用指定类型压缩
+func Compress(data []byte, t CompressionType) ([]byte, error) {
+	c := GetCompressor(t)
+	if c == nil {
+		return nil, errors.New("compressor not found")
+	}
+	return c.Compress(data)
+}
+
+// AppendCompress 使用指定类型压缩，结果追加到 dst 之后；出错时返回原始的 dst
+func AppendCompress(dst, data []byte, t CompressionType) ([]byte, error) {
+	c := GetCompressor(t)
+	if c == nil {
+		return dst, errors.New("compressor not found")
+	}
+	if ac, ok := c.(AppendCompressor); ok {
+		return ac.AppendCompress(dst, data)
+	}
+
+	out, err := c.Compress(data)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, out...), nil
+}
+
+// Decompress 使用指定类型解压
+func Decompress(data []byte, t CompressionType) ([]byte, error) {
+	return DecompressLimit(data, t, -1)
+}
+
+// DecompressLimit 使用指定类型解压，解压后超过 limit 字节时返回 ErrTooLarge
+func DecompressLimit(data []byte, t CompressionType, limit int) ([]byte, error) {
+	c := GetCompressor(t)
+	if c == nil {
+		return nil, errors.New("compressor not found")
+	}
+	return c.Decompress(data, limit)
+}
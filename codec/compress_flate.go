@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// DeflateCompressor 原始 deflate 流，没有 gzip 的头部和校验，比 gzip 少 18 字节
+type DeflateCompressor struct{}
+
+var (
+	flateWriterPool = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	flateReaderPool sync.Pool // io.ReadCloser，同时实现了 flate.Resetter
+)
+
+func (d *DeflateCompressor) Compress(data []byte) ([]byte, error) {
+	return d.AppendCompress(nil, data)
+}
+
+func (d *DeflateCompressor) AppendCompress(dst, data []byte) ([]byte, error) {
+	w := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(w)
+
+	buf := bytes.NewBuffer(dst)
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *DeflateCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	src := bytes.NewReader(data)
+
+	r, ok := flateReaderPool.Get().(io.ReadCloser)
+	if ok {
+		_ = r.(flate.Resetter).Reset(src, nil)
+	} else {
+		r = flate.NewReader(src)
+	}
+	defer flateReaderPool.Put(r)
+
+	return ReadAllLimit(r, limit)
+}
+
+// ZlibCompressor zlib 格式，在 deflate 的基础上带 Adler-32 校验
+type ZlibCompressor struct{}
+
+var (
+	zlibWriterPool = sync.Pool{New: func() interface{} { return zlib.NewWriter(nil) }}
+	zlibReaderPool sync.Pool // io.ReadCloser，同时实现了 zlib.Resetter
+)
+
+func (z *ZlibCompressor) Compress(data []byte) ([]byte, error) {
+	return z.AppendCompress(nil, data)
+}
+
+func (z *ZlibCompressor) AppendCompress(dst, data []byte) ([]byte, error) {
+	w := zlibWriterPool.Get().(*zlib.Writer)
+	defer zlibWriterPool.Put(w)
+
+	buf := bytes.NewBuffer(dst)
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (z *ZlibCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	src := bytes.NewReader(data)
+
+	// zlib.NewReader 会立即读取头部，不能像 flate 那样用空 reader 预先创建
+	r, ok := zlibReaderPool.Get().(io.ReadCloser)
+	if ok {
+		if err := r.(zlib.Resetter).Reset(src, nil); err != nil {
+			zlibReaderPool.Put(r)
+			return nil, err
+		}
+	} else {
+		var err error
+		if r, err = zlib.NewReader(src); err != nil {
+			return nil, err
+		}
+	}
+	defer zlibReaderPool.Put(r)
+
+	return ReadAllLimit(r, limit)
+}
+
+func init() {
+	mustRegisterCompressor(CompressionDeflate, &DeflateCompressor{})
+	mustRegisterCompressor(CompressionZlib, &ZlibCompressor{})
+}
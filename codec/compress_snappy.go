@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"slices"
+
+	"github.com/golang/snappy"
+)
+
+// SnappyCompressor snappy 块格式，纯 Go 实现，适合对延迟敏感的流量
+type SnappyCompressor struct{}
+
+func (s *SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (s *SnappyCompressor) AppendCompress(dst, data []byte) ([]byte, error) {
+	n := snappy.MaxEncodedLen(len(data))
+	if n < 0 {
+		return dst, snappy.ErrTooLarge
+	}
+
+	dst = slices.Grow(dst, n)
+	encoded := snappy.Encode(dst[len(dst):len(dst)+n], data)
+	return dst[:len(dst)+len(encoded)], nil
+}
+
+// Decompress 块格式在开头记录了解压后的长度，超过 limit 时不分配内存直接拒绝
+func (s *SnappyCompressor) Decompress(data []byte, limit int) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && n > limit {
+		return nil, ErrTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+func init() {
+	mustRegisterCompressor(CompressionSnappy, &SnappyCompressor{})
+}
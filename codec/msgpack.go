@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const MSGPACK Type = 3
+
+// msgpackCodec 直接编码普通的 Go 结构体，不需要 .proto 定义，
+// 编码结果比 JSON 更小，编解码也更快。
+// 字段名优先使用 msgpack tag，没有时使用 json tag，都没有时使用字段名
+type msgpackCodec struct{}
+
+func (m *msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+
+	// Reset 会清空 tag 设置，必须在之后设置
+	enc.Reset(&buf)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	return dec.Decode(v)
+}
+
+func init() {
+	Register(MSGPACK, func() Codec {
+		return &msgpackCodec{}
+	})
+}
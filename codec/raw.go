@@ -0,0 +1,37 @@
+package codec
+
+import "fmt"
+
+const RAW Type = 4
+
+// rawCodec 原样传递已经序列化好的数据，只接受 []byte 和 *[]byte，
+// 用于代理、回放等不关心具体类型的场景
+type rawCodec struct{}
+
+func (r *rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		if b == nil {
+			return nil, nil
+		}
+		return *b, nil
+	}
+	return nil, fmt.Errorf("raw codec: expected []byte or *[]byte, got %T", v)
+}
+
+func (r *rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec: expected *[]byte, got %T", v)
+	}
+	*b = data
+	return nil
+}
+
+func init() {
+	Register(RAW, func() Codec {
+		return &rawCodec{}
+	})
+}
@@ -119,6 +119,16 @@ func (cb *CircuitBreaker) RecordFailure() {
 		// 已经熔断，不处理
 	}
 }
+
+// RecordIgnored 结束一次不计入统计的请求，半开状态下交还探测名额
+func (cb *CircuitBreaker) RecordIgnored() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == HalfOpen {
+		cb.halfOpenProbe = false
+	}
+}
 func (cb *CircuitBreaker) toOpen() {
 	cb.state = Open
 	cb.lastStateChange = time.Now()
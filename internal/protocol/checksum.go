@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// FlagChecksum 版本字节的最高位，置位时帧尾追加 4 字节的 CRC32 校验和
+//
+// 帧布局: Magic(2) | Version(1) | headerLen(3) | bodyLen(4) | header | body | CRC32(4)
+//
+// 校验和覆盖校验和之前的全部字节（body 为压缩后的数据），只在握手协商开启后使用，
+// 旧版本对端不会收到带校验和的帧
+const FlagChecksum byte = 0x80
+
+// ChecksumSize 校验和占用的字节数
+const ChecksumSize = 4
+
+// ErrChecksumMismatch 帧的校验和与内容不一致，数据在传输中被破坏
+var ErrChecksumMismatch = errors.New("protocol: checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// HasChecksum 判断帧是否带校验和，prefix 至少包含前 3 个字节
+func HasChecksum(prefix []byte) bool {
+	return prefix[2]&FlagChecksum != 0
+}
+
+// FrameLen 根据帧的前 10 个字节计算整帧的长度
+func FrameLen(prefix []byte) int {
+	n := 10 + int(DecodeHeaderLen(prefix[2:6])) + int(DecodeBodyLen(prefix[6:10]))
+	if HasChecksum(prefix) {
+		n += ChecksumSize
+	}
+	return n
+}
+
+// appendChecksum 在 dst 末尾追加 dst[start:] 这一帧的校验和
+func appendChecksum(dst []byte, start int) []byte {
+	return binary.BigEndian.AppendUint32(dst, crc32.Checksum(dst[start:], castagnoli))
+}
+
+// verifyChecksum 校验整帧的校验和，frame 包含尾部的 4 字节校验和
+func verifyChecksum(frame []byte) error {
+	n := len(frame) - ChecksumSize
+	want := binary.BigEndian.Uint32(frame[n:])
+	if got := crc32.Checksum(frame[:n], castagnoli); got != want {
+		return frameErrorf(ErrChecksumMismatch, "got 0x%08x, want 0x%08x", got, want)
+	}
+	return nil
+}
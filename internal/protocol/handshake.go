@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"fmt"
+	"kamaRPC/codec"
+	"slices"
+)
+
+// 握手 Flags 各个位的含义
+const (
+	handshakeFlagChecksum byte = 1 << iota
+	handshakeFlagHeartbeat
+)
+
+// SupportedVersions 本端能够解码的全部协议版本
+var SupportedVersions = []Version{VersionJSON, VersionBinary}
+
+// Handshake 建连后双方交换的能力声明
+//
+// 客户端按偏好顺序列出自己支持的协议版本、codec 和压缩算法，
+// 服务端选出双方共同支持的部分原样回复，协商失败时只回复 Error
+type Handshake struct {
+	Versions     []Version
+	Codecs       []codec.Type
+	Compressions []codec.CompressionType
+	Error        string
+	// Checksum 客户端请求对每一帧做 CRC32 校验，服务端支持时在结果中保留
+	Checksum bool
+	// Heartbeat 本端会回复 TypePing，双方都支持时才发送心跳、检测读超时
+	Heartbeat bool
+}
+
+// Negotiate 服务端根据双方的能力声明选出连接最终使用的参数
+//
+// 协议版本取共同支持的最高版本，codec 和压缩算法保留客户端的偏好顺序，
+// 不压缩总是可用的，因此压缩算法允许没有交集
+func Negotiate(local, remote *Handshake) (*Handshake, error) {
+	result := &Handshake{}
+
+	for _, v := range remote.Versions {
+		if slices.Contains(local.Versions, v) && (len(result.Versions) == 0 || v > result.Versions[0]) {
+			result.Versions = []Version{v}
+		}
+	}
+	if len(result.Versions) == 0 {
+		return nil, fmt.Errorf("handshake: no common protocol version, server %v client %v",
+			local.Versions, remote.Versions)
+	}
+
+	for _, t := range remote.Codecs {
+		if slices.Contains(local.Codecs, t) {
+			result.Codecs = append(result.Codecs, t)
+		}
+	}
+	if len(result.Codecs) == 0 {
+		return nil, fmt.Errorf("handshake: no common codec, server %v client %v",
+			local.Codecs, remote.Codecs)
+	}
+
+	for _, t := range remote.Compressions {
+		if slices.Contains(local.Compressions, t) {
+			result.Compressions = append(result.Compressions, t)
+		}
+	}
+
+	result.Checksum = local.Checksum && remote.Checksum
+	result.Heartbeat = local.Heartbeat && remote.Heartbeat
+
+	return result, nil
+}
+
+// Version 返回协商出的协议版本
+func (h *Handshake) Version() Version {
+	if len(h.Versions) == 0 {
+		return VersionJSON
+	}
+	return h.Versions[0]
+}
+
+// HasCodec 判断 codec 是否在协商结果中
+func (h *Handshake) HasCodec(t codec.Type) bool {
+	return slices.Contains(h.Codecs, t)
+}
+
+// HasCompression 判断压缩算法是否在协商结果中，不压缩总是可用
+func (h *Handshake) HasCompression(t codec.CompressionType) bool {
+	return t == codec.CompressionNone || slices.Contains(h.Compressions, t)
+}
+
+// 握手 body 布局: Versions | Codecs | Compressions | Error | Flags(1)，
+// 前三项均为 uvarint 长度 + 每项 1 字节。
+// Flags 是后来追加的，旧版本不写也不读，缺失时视为 0
+func (h *Handshake) Marshal() []byte {
+	buf := make([]byte, 0, 16+len(h.Error))
+
+	versions := make([]byte, len(h.Versions))
+	for i, v := range h.Versions {
+		versions[i] = byte(v)
+	}
+	codecs := make([]byte, len(h.Codecs))
+	for i, t := range h.Codecs {
+		codecs[i] = byte(t)
+	}
+	compressions := make([]byte, len(h.Compressions))
+	for i, t := range h.Compressions {
+		compressions[i] = byte(t)
+	}
+
+	buf = appendBytes(buf, versions)
+	buf = appendBytes(buf, codecs)
+	buf = appendBytes(buf, compressions)
+	buf = appendString(buf, h.Error)
+
+	var flags byte
+	if h.Checksum {
+		flags |= handshakeFlagChecksum
+	}
+	if h.Heartbeat {
+		flags |= handshakeFlagHeartbeat
+	}
+	buf = append(buf, flags)
+	return buf
+}
+
+func (h *Handshake) Unmarshal(data []byte) error {
+	versions, data, err := readBytes(data)
+	if err != nil {
+		return err
+	}
+	codecs, data, err := readBytes(data)
+	if err != nil {
+		return err
+	}
+	compressions, data, err := readBytes(data)
+	if err != nil {
+		return err
+	}
+	if h.Error, data, err = readString(data); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		h.Checksum = data[0]&handshakeFlagChecksum != 0
+		h.Heartbeat = data[0]&handshakeFlagHeartbeat != 0
+	}
+
+	h.Versions = make([]Version, len(versions))
+	for i, v := range versions {
+		h.Versions[i] = Version(v)
+	}
+	h.Codecs = make([]codec.Type, len(codecs))
+	for i, t := range codecs {
+		h.Codecs[i] = codec.Type(t)
+	}
+	h.Compressions = make([]codec.CompressionType, len(compressions))
+	for i, t := range compressions {
+		h.Compressions[i] = codec.CompressionType(t)
+	}
+	return nil
+}
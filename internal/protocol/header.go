@@ -1,20 +1,292 @@
 package protocol
 
-import "kamaRPC/internal/codec"
+import (
+	"encoding/binary"
+	"errors"
+	"kamaRPC/codec"
+	"kamaRPC/status"
+	"math"
+	"slices"
+	"time"
+)
 
-// CodecType 编解码器类型
-type CodecType byte
+// MessageType 帧的类型
+type MessageType byte
 
 const (
-	CodecTypeJSON CodecType = iota + 1
-	CodecTypeProto
+	// TypeCall 普通的请求/响应，旧版本的帧都属于这一类
+	TypeCall MessageType = iota
+	// TypeHandshake 建连后交换的握手帧，body 为编码后的 Handshake
+	TypeHandshake
+
+	// 流式调用的帧，RequestID 即流 ID
+
+	// TypeStreamOpen 客户端打开流，携带 ServiceName/MethodName/Metadata
+	TypeStreamOpen
+	// TypeStreamData 流上的一条消息
+	TypeStreamData
+	// TypeStreamHalfClose 发送方不再发送消息，对端 Recv 将返回 io.EOF
+	TypeStreamHalfClose
+	// TypeStreamClose 正常结束整个流
+	TypeStreamClose
+	// TypeStreamError 以 Header.Error 结束整个流
+	TypeStreamError
+
+	// TypeCancel 调用方放弃了 RequestID 对应的请求，服务端取消 handler 的 ctx
+	TypeCancel
+
+	// TypePing 心跳，握手协商支持心跳的对端收到后回复 RequestID 相同的 TypePong
+	TypePing
+	// TypePong 心跳的回复
+	TypePong
 )
 
+// IsStream 判断是否为流式调用的帧
+func (t MessageType) IsStream() bool {
+	return t >= TypeStreamOpen && t <= TypeStreamError
+}
+
 type Header struct {
+	Type        MessageType
 	RequestID   uint64
 	ServiceName string
 	MethodName  string
 	Error       string
-	CodecType   CodecType
+	// CodecType 请求 body 使用的 codec，0 表示旧版本客户端没有声明，服务端使用默认 codec
+	CodecType   codec.Type
 	Compression codec.CompressionType
+	// Metadata 请求方向为调用方附带的元数据，响应方向为 handler 设置的 trailer
+	Metadata map[string]string
+	// Code 响应的状态码，Error 为对应的 message，旧版本只设置 Error
+	Code    status.Code
+	Details []status.Detail
+	// Timeout 请求剩余的超时时间，服务端从收到请求时开始计时，0 表示没有截止时间
+	Timeout time.Duration
+	// OneWay 单向调用，服务端执行后不回复响应
+	OneWay bool
+}
+
+// SetError 把 err 转换成状态码、message 和详情写入 header
+func (h *Header) SetError(err error) {
+	st := status.Convert(err)
+	h.Code = st.Code()
+	h.Error = st.Message()
+	h.Details = st.Details()
+}
+
+// Err 从 header 还原出状态错误，没有错误时返回 nil
+func (h *Header) Err() error {
+	if h.Code == status.OK && h.Error == "" {
+		return nil
+	}
+
+	code := h.Code
+	if code == status.OK {
+		// 旧版本对端只会设置 Error
+		code = status.Unknown
+	}
+	return status.New(code, h.Error).WithDetails(h.Details...)
+}
+
+var errTruncated = errors.New("protocol: truncated binary data")
+
+// 二进制 header 中 Flags 字节的各个比特位
+const (
+	flagOneWay byte = 1 << iota
+)
+
+// 二进制 header 布局（VersionBinary）:
+//
+//	RequestID(8) | CodecType(1) | Compression(1) |
+//	ServiceName(uvarint 长度 + 字节) | MethodName(同上) | Error(同上) |
+//	Type(1) | Metadata(uvarint 个数 + 若干 key/value 字符串) |
+//	Code(uvarint) | Details(uvarint 个数 + 若干 Type 字符串/Value 字节) |
+//	Timeout(uvarint 纳秒) | Flags(1)
+//
+// 新字段只能追加在末尾，解码时忽略多余的尾部字节，保证新旧版本可以互通
+//
+// appendHeaderBinary 把编码结果追加到 buf 之后
+func appendHeaderBinary(buf []byte, h *Header) []byte {
+	size := 8 + 1 + 1 +
+		binary.MaxVarintLen64*3 +
+		len(h.ServiceName) + len(h.MethodName) + len(h.Error) +
+		1 + binary.MaxVarintLen64
+	for k, v := range h.Metadata {
+		size += binary.MaxVarintLen64*2 + len(k) + len(v)
+	}
+	size += binary.MaxVarintLen64*3 + 1
+	for _, d := range h.Details {
+		size += binary.MaxVarintLen64*2 + len(d.Type) + len(d.Value)
+	}
+
+	buf = slices.Grow(buf, size)
+	buf = binary.BigEndian.AppendUint64(buf, h.RequestID)
+	buf = append(buf, byte(h.CodecType), byte(h.Compression))
+	buf = appendString(buf, h.ServiceName)
+	buf = appendString(buf, h.MethodName)
+	buf = appendString(buf, h.Error)
+	buf = append(buf, byte(h.Type))
+	buf = appendMetadata(buf, h.Metadata)
+	buf = binary.AppendUvarint(buf, uint64(h.Code))
+	buf = binary.AppendUvarint(buf, uint64(len(h.Details)))
+	for _, d := range h.Details {
+		buf = appendString(buf, d.Type)
+		buf = appendBytes(buf, d.Value)
+	}
+	buf = binary.AppendUvarint(buf, uint64(max(h.Timeout, 0)))
+
+	var flags byte
+	if h.OneWay {
+		flags |= flagOneWay
+	}
+	buf = append(buf, flags)
+	return buf
+}
+
+func unmarshalHeaderBinary(data []byte, h *Header) error {
+	if len(data) < 10 {
+		return errTruncated
+	}
+
+	h.RequestID = binary.BigEndian.Uint64(data[0:8])
+	h.CodecType = codec.Type(data[8])
+	h.Compression = codec.CompressionType(data[9])
+	data = data[10:]
+
+	var err error
+	if h.ServiceName, data, err = readString(data); err != nil {
+		return err
+	}
+	if h.MethodName, data, err = readString(data); err != nil {
+		return err
+	}
+	if h.Error, data, err = readString(data); err != nil {
+		return err
+	}
+
+	// 以下为追加字段，旧版本写出的 header 里可能没有
+	if len(data) == 0 {
+		return nil
+	}
+	h.Type = MessageType(data[0])
+	data = data[1:]
+
+	if len(data) == 0 {
+		return nil
+	}
+	if h.Metadata, data, err = readMetadata(data); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	if h.Code, h.Details, data, err = readStatus(data); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	timeout, size := binary.Uvarint(data)
+	if size <= 0 || timeout > math.MaxInt64 {
+		return errTruncated
+	}
+	h.Timeout = time.Duration(timeout)
+	data = data[size:]
+
+	if len(data) == 0 {
+		return nil
+	}
+	h.OneWay = data[0]&flagOneWay != 0
+	return nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func appendMetadata(buf []byte, md map[string]string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(md)))
+	for k, v := range md {
+		buf = appendString(buf, k)
+		buf = appendString(buf, v)
+	}
+	return buf
+}
+
+func readMetadata(data []byte) (map[string]string, []byte, error) {
+	n, size := binary.Uvarint(data)
+	// 每个 key/value 至少占 2 个字节，避免按伪造的个数分配过大的 map
+	if size <= 0 || n > uint64(len(data)-size)/2 {
+		return nil, nil, errTruncated
+	}
+	data = data[size:]
+	if n == 0 {
+		return nil, data, nil
+	}
+
+	md := make(map[string]string, n)
+	for i := uint64(0); i < n; i++ {
+		var k, v string
+		var err error
+		if k, data, err = readString(data); err != nil {
+			return nil, nil, err
+		}
+		if v, data, err = readString(data); err != nil {
+			return nil, nil, err
+		}
+		md[k] = v
+	}
+	return md, data, nil
+}
+
+func readStatus(data []byte) (status.Code, []status.Detail, []byte, error) {
+	code, size := binary.Uvarint(data)
+	if size <= 0 {
+		return 0, nil, nil, errTruncated
+	}
+	data = data[size:]
+
+	n, size := binary.Uvarint(data)
+	// 每个详情至少占 2 个字节
+	if size <= 0 || n > uint64(len(data)-size)/2 {
+		return 0, nil, nil, errTruncated
+	}
+	data = data[size:]
+
+	var details []status.Detail
+	for i := uint64(0); i < n; i++ {
+		var d status.Detail
+		var err error
+		if d.Type, data, err = readString(data); err != nil {
+			return 0, nil, nil, err
+		}
+		if d.Value, data, err = readBytes(data); err != nil {
+			return 0, nil, nil, err
+		}
+		d.Value = append([]byte(nil), d.Value...)
+		details = append(details, d)
+	}
+	return status.Code(code), details, data, nil
+}
+
+func readString(data []byte) (string, []byte, error) {
+	b, rest, err := readBytes(data)
+	return string(b), rest, err
+}
+
+func readBytes(data []byte) ([]byte, []byte, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return nil, nil, errTruncated
+	}
+	data = data[size:]
+	return data[:n], data[n:], nil
 }
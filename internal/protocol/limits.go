@@ -0,0 +1,81 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	// DefaultMaxHeaderSize 默认允许的最大 header 长度
+	DefaultMaxHeaderSize = 64 << 10
+	// DefaultMaxBodySize 默认允许的最大 body 长度，同时限制压缩前后的大小
+	DefaultMaxBodySize = 16 << 20
+)
+
+// Limits 解码时对帧大小的限制，零值字段使用默认值
+type Limits struct {
+	MaxHeaderSize int
+	MaxBodySize   int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxHeaderSize <= 0 || l.MaxHeaderSize > MaxHeaderLen {
+		l.MaxHeaderSize = min(DefaultMaxHeaderSize, MaxHeaderLen)
+	}
+	if l.MaxBodySize <= 0 {
+		l.MaxBodySize = DefaultMaxBodySize
+	}
+	return l
+}
+
+var (
+	ErrInvalidMagic   = errors.New("protocol: invalid magic number")
+	ErrFrameTooLarge  = errors.New("protocol: frame too large")
+	ErrMalformedFrame = errors.New("protocol: malformed frame")
+)
+
+// FrameError 收到的帧不合法，连接上后续的字节已经无法信任，必须关闭连接
+//
+// Kind 为 ErrInvalidMagic、ErrFrameTooLarge、ErrMalformedFrame 或 ErrChecksumMismatch，
+// 可以用 errors.Is 判断
+type FrameError struct {
+	Kind error
+	Msg  string
+}
+
+func (e *FrameError) Error() string {
+	return e.Kind.Error() + ": " + e.Msg
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Kind
+}
+
+func frameErrorf(kind error, format string, a ...interface{}) *FrameError {
+	return &FrameError{Kind: kind, Msg: fmt.Sprintf(format, a...)}
+}
+
+// CheckPrefix 校验帧的前 10 个字节，在缓冲整帧之前就拒绝伪造的长度
+func CheckPrefix(prefix []byte, limits Limits) error {
+	limits = limits.withDefaults()
+
+	if magic := binary.BigEndian.Uint16(prefix[0:2]); magic != Magic {
+		return frameErrorf(ErrInvalidMagic, "got 0x%04x", magic)
+	}
+
+	if version := DecodeVersion(prefix[2:3]); !slices.Contains(SupportedVersions, version) {
+		return frameErrorf(ErrMalformedFrame, "unsupported protocol version %d", version)
+	}
+
+	if headerLen := DecodeHeaderLen(prefix[2:6]); int64(headerLen) > int64(limits.MaxHeaderSize) {
+		return frameErrorf(ErrFrameTooLarge, "header %d bytes exceeds limit %d", headerLen, limits.MaxHeaderSize)
+	}
+
+	if bodyLen := DecodeBodyLen(prefix[6:10]); int64(bodyLen) > int64(limits.MaxBodySize) {
+		return frameErrorf(ErrFrameTooLarge, "body %d bytes exceeds limit %d", bodyLen, limits.MaxBodySize)
+	}
+
+	return nil
+}
@@ -2,65 +2,114 @@ package protocol
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"kamaRPC/internal/codec"
+	"kamaRPC/codec"
 )
 
 const Magic uint16 = 0x1234
 
+// Version 协议版本，占用 Magic 之后的 1 个字节
+//
+// 帧布局: Magic(2) | Version(1) | headerLen(3) | bodyLen(4) | header | body
+//
+// 旧版本的帧在这个位置是 4 字节 headerLen 的最高字节，恒为 0，
+// 因此旧帧天然被识别为 VersionJSON，混合版本的集群可以继续互通
+type Version byte
+
+const (
+	// VersionJSON 旧版协议，header 使用 JSON 编码
+	VersionJSON Version = iota
+	// VersionBinary header 使用紧凑的二进制编码
+	VersionBinary
+)
+
+// CurrentVersion 默认写出的协议版本
+const CurrentVersion = VersionBinary
+
+// MaxHeaderLen headerLen 只有 3 个字节可用
+const MaxHeaderLen = 1<<24 - 1
+
 type Message struct {
 	Header *Header
 	Body   []byte
 }
 
+// Encode 使用 CurrentVersion 编码
 func Encode(msg *Message) ([]byte, error) {
+	return AppendFrame(nil, msg, CurrentVersion, false)
+}
+
+// AppendFrame 把 msg 编码成一帧追加到 dst 之后，checksum 为 true 时在帧尾追加校验和。
+//
+// header 和压缩后的 body 直接写入 dst，调用方复用 dst 的底层数组即可避免每帧分配新的缓冲区，
+// 出错时返回原始的 dst
+func AppendFrame(dst []byte, msg *Message, version Version, checksum bool) ([]byte, error) {
 
 	if msg.Header == nil {
-		return nil, fmt.Errorf("header is nil")
+		return dst, fmt.Errorf("header is nil")
 	}
 
-	bodyBytes := msg.Body
+	start := len(dst)
 
-	if msg.Header.Compression != codec.CompressionNone {
-		var err error
-		bodyBytes, err = codec.Compress(bodyBytes, msg.Header.Compression)
-		if err != nil {
-			return nil, err
+	// 先占住 10 字节的前缀，长度在 header 和 body 写完后回填
+	dst = append(dst, make([]byte, 10)...)
+
+	var err error
+	switch version {
+	case VersionBinary:
+		dst = appendHeaderBinary(dst, msg.Header)
+	default:
+		var headerBytes []byte
+		if headerBytes, err = marshalHeader(msg.Header, version); err != nil {
+			return dst[:start], err
 		}
+		dst = append(dst, headerBytes...)
 	}
 
-	headerCodec, err := codec.New(codec.JSON)
-	if err != nil {
-		return nil, err
+	headerLen := len(dst) - start - 10
+	if headerLen > MaxHeaderLen {
+		return dst[:start], fmt.Errorf("header too large: %d bytes", headerLen)
 	}
 
-	headerBytes, err := headerCodec.Marshal(msg.Header)
-	if err != nil {
-		return nil, err
+	bodyStart := len(dst)
+	if msg.Header.Compression != codec.CompressionNone {
+		compressed, err := codec.AppendCompress(dst, msg.Body, msg.Header.Compression)
+		if err != nil {
+			return dst[:start], err
+		}
+		dst = compressed
+	} else {
+		dst = append(dst, msg.Body...)
 	}
+	bodyLen := len(dst) - bodyStart
 
-	headerLen := uint32(len(headerBytes))
-	bodyLen := uint32(len(bodyBytes))
-
-	total := 2 + 4 + 4 + headerLen + bodyLen
-	buf := make([]byte, total)
-
-	binary.BigEndian.PutUint16(buf[0:2], Magic)
+	prefix := dst[start : start+10]
+	binary.BigEndian.PutUint16(prefix[0:2], Magic)
 
-	binary.BigEndian.PutUint32(buf[2:6], headerLen)
+	binary.BigEndian.PutUint32(prefix[2:6], uint32(headerLen))
+	prefix[2] = byte(version)
+	if checksum {
+		prefix[2] |= FlagChecksum
+	}
 
-	binary.BigEndian.PutUint32(buf[6:10], bodyLen)
+	binary.BigEndian.PutUint32(prefix[6:10], uint32(bodyLen))
 
-	copy(buf[10:], headerBytes)
+	if checksum {
+		dst = appendChecksum(dst, start)
+	}
 
-	copy(buf[10+headerLen:], bodyBytes)
+	return dst, nil
+}
 
-	return buf, nil
+// DecodeVersion 从字节切片解析协议版本（去掉校验和标志位）
+func DecodeVersion(data []byte) Version {
+	return Version(data[0] &^ FlagChecksum)
 }
 
-// DecodeHeaderLen 从字节切片解析 headerLen
+// DecodeHeaderLen 从字节切片解析 headerLen（去掉最高字节的版本号）
 func DecodeHeaderLen(data []byte) uint32 {
-	return binary.BigEndian.Uint32(data)
+	return binary.BigEndian.Uint32(data) & MaxHeaderLen
 }
 
 // DecodeBodyLen 从字节切片解析 bodyLen
@@ -68,45 +117,58 @@ func DecodeBodyLen(data []byte) uint32 {
 	return binary.BigEndian.Uint32(data)
 }
 
-// DecodeBytes 从字节数组解码完整的 Message（用于粘包处理）
+// DecodeBytes 从字节数组解码完整的 Message（用于粘包处理），使用默认的大小限制
 func Decode(data []byte) (*Message, error) {
+	return DecodeLimits(data, Limits{})
+}
+
+// DecodeLimits 按 limits 校验并解码完整的 Message，帧不合法时返回 *FrameError
+func DecodeLimits(data []byte, limits Limits) (*Message, error) {
+	limits = limits.withDefaults()
 
 	if len(data) < 10 {
-		return nil, fmt.Errorf("data too short")
+		return nil, frameErrorf(ErrMalformedFrame, "data too short")
 	}
 
-	// 检查 Magic
-	if binary.BigEndian.Uint16(data[0:2]) != Magic {
-		return nil, fmt.Errorf("invalid magic number")
+	// 检查 Magic、版本和长度
+	if err := CheckPrefix(data[:10], limits); err != nil {
+		return nil, err
 	}
 
-	headerLen := binary.BigEndian.Uint32(data[2:6])
-	bodyLen := binary.BigEndian.Uint32(data[6:10])
+	version := DecodeVersion(data[2:3])
+	headerLen := DecodeHeaderLen(data[2:6])
+	bodyLen := DecodeBodyLen(data[6:10])
 
-	totalLen := 10 + int(headerLen) + int(bodyLen)
+	totalLen := FrameLen(data[:10])
 	if len(data) < totalLen {
-		return nil, fmt.Errorf("incomplete packet")
+		return nil, frameErrorf(ErrMalformedFrame, "incomplete packet")
 	}
 
-	headerBytes := data[10 : 10+headerLen]
-
-	headerCodec, err := codec.New(codec.JSON)
-	if err != nil {
-		return nil, err
+	// 先校验再解析，被破坏的帧不会进入后续的解码流程
+	if HasChecksum(data) {
+		if err := verifyChecksum(data[:totalLen]); err != nil {
+			return nil, err
+		}
 	}
 
+	headerBytes := data[10 : 10+headerLen]
+
 	var header Header
-	if err := headerCodec.Unmarshal(headerBytes, &header); err != nil {
-		return nil, err
+	if err := unmarshalHeader(headerBytes, &header, version); err != nil {
+		return nil, frameErrorf(ErrMalformedFrame, "header: %v", err)
 	}
 
 	// 读取 body
 	bodyBytes := data[10+headerLen : 10+headerLen+bodyLen]
 
 	if header.Compression != codec.CompressionNone {
-		bodyBytes, err = codec.Decompress(bodyBytes, header.Compression)
+		var err error
+		bodyBytes, err = codec.DecompressLimit(bodyBytes, header.Compression, limits.MaxBodySize)
+		if errors.Is(err, codec.ErrTooLarge) {
+			return nil, frameErrorf(ErrFrameTooLarge, "decompressed body exceeds limit %d", limits.MaxBodySize)
+		}
 		if err != nil {
-			return nil, err
+			return nil, frameErrorf(ErrMalformedFrame, "body: %v", err)
 		}
 	}
 
@@ -115,3 +177,33 @@ func Decode(data []byte) (*Message, error) {
 		Body:   bodyBytes,
 	}, nil
 }
+
+func marshalHeader(h *Header, version Version) ([]byte, error) {
+	switch version {
+	case VersionBinary:
+		return appendHeaderBinary(nil, h), nil
+	case VersionJSON:
+		headerCodec, err := codec.New(codec.JSON)
+		if err != nil {
+			return nil, err
+		}
+		return headerCodec.Marshal(h)
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	}
+}
+
+func unmarshalHeader(data []byte, h *Header, version Version) error {
+	switch version {
+	case VersionBinary:
+		return unmarshalHeaderBinary(data, h)
+	case VersionJSON:
+		headerCodec, err := codec.New(codec.JSON)
+		if err != nil {
+			return err
+		}
+		return headerCodec.Unmarshal(data, h)
+	default:
+		return fmt.Errorf("unsupported protocol version %d", version)
+	}
+}
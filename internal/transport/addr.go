@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unix 域套接字地址的前缀，例如 unix:///run/kama.sock，
+// 用于与同机的 sidecar 通信，省去回环 TCP 的协议栈开销
+const unixScheme = "unix://"
+
+// ParseAddr 把地址拆成 net.Dial/net.Listen 使用的 network 和 address，
+// unix:// 开头的地址为 unix 域套接字，mem:// 开头的地址为进程内的内存连接（network 为 mem），
+// 其余按 TCP 的 host:port 处理
+func ParseAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, unixScheme); ok {
+		return "unix", path
+	}
+	if name, ok := strings.CutPrefix(addr, memScheme); ok {
+		return "mem", name
+	}
+	return "tcp", strings.TrimPrefix(addr, "tcp://")
+}
+
+// Dial 按地址的类型建立连接，ctx 结束时放弃
+func Dial(ctx context.Context, addr string) (net.Conn, error) {
+	network, address := ParseAddr(addr)
+	if network == "mem" {
+		return dialMem(ctx, address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// Listen 按地址的类型监听。
+//
+// unix 域套接字的文件在监听器关闭时删除；上次进程异常退出残留的套接字文件
+// 在确认没有进程监听后会先被删除，正在被使用的地址返回错误
+func Listen(addr string) (net.Listener, error) {
+	network, address := ParseAddr(addr)
+	switch network {
+	case "mem":
+		return listenMem(address)
+	case "tcp":
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is already in use", path)
+	}
+	return os.Remove(path)
+}
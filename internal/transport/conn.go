@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"kamaRPC/internal/protocol"
+	"kamaRPC/peer"
+	"time"
+)
+
+// Conn 按帧收发消息的连接。服务端的 handler、流和客户端都只依赖这个接口，
+// 不关心底层是 TCP、unix 域套接字、TLS 还是内存管道，这些差别由 Dialer 和 Listener 处理
+type Conn interface {
+	// Read 读取一帧，同一时间只能有一个 goroutine 调用
+	Read() (*protocol.Message, error)
+	// Write 写出一帧，可以被多个 goroutine 同时调用
+	Write(msg *protocol.Message) error
+	// Close 关闭连接，可以重复调用
+	Close() error
+
+	RemoteAddr() string
+	// Peer 返回对端的地址和 TLS 状态
+	Peer() *peer.Peer
+
+	// Negotiated 返回握手协商出的结果，对端没有握手时返回 nil
+	Negotiated() *protocol.Handshake
+	// SetNegotiated 记录握手协商出的结果，之后写出的帧按结果选择协议版本和校验和
+	SetNegotiated(hs *protocol.Handshake)
+	// SetDeadline 设置底层连接的读写截止时间，用于限制握手的耗时
+	SetDeadline(t time.Time) error
+}
+
+var _ Conn = (*TCPConnection)(nil)
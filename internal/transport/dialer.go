@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+// Dialer 建立到 addr 的底层连接，连接建立后由 NewTCPConnection 负责分帧和握手。
+//
+// 新的承载方式只需要实现 Dialer 和 Listener，handler、连接池和客户端的代码不需要修改
+type Dialer interface {
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// DialFunc 把普通函数适配成 Dialer
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+func (f DialFunc) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return f(ctx, addr)
+}
+
+// Listener 在 addr 上监听底层连接
+type Listener interface {
+	Listen(addr string) (net.Listener, error)
+}
+
+// ListenFunc 把普通函数适配成 Listener
+type ListenFunc func(addr string) (net.Listener, error)
+
+func (f ListenFunc) Listen(addr string) (net.Listener, error) {
+	return f(addr)
+}
+
+// NetDialer 按地址的类型连接 TCP、unix 域套接字或进程内的内存管道，见 ParseAddr
+type NetDialer struct{}
+
+func (NetDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return Dial(ctx, addr)
+}
+
+// NetListener 按地址的类型监听 TCP、unix 域套接字或进程内的内存管道，见 ParseAddr
+type NetListener struct{}
+
+func (NetListener) Listen(addr string) (net.Listener, error) {
+	return Listen(addr)
+}
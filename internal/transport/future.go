@@ -2,26 +2,56 @@ package transport
 
 import (
 	"context"
-	"kamaRPC/internal/codec"
+	"kamaRPC/codec"
+	"kamaRPC/metadata"
+	"kamaRPC/status"
 	"sync"
 	"time"
 )
 
 type Future struct {
-	done  chan struct{}
-	res   []byte
-	err   error
-	mu    sync.Mutex
-	codec codec.Codec
+	done chan struct{}
+	res  []byte
+	err  error
+	mu   sync.Mutex
+
+	// 解码结果使用的 codec，默认是编码请求的 codec，响应声明了其他 codec 时以响应为准
+	codec     codec.Codec
+	codecType codec.Type
+
+	// 服务端随响应返回的元数据，在 done 关闭前写入
+	trailer metadata.MD
 
 	onComplete func(error)
+	// Done 已经被调用，之后注册的 onComplete 立即执行
+	completed bool
+
+	// 调用方放弃等待时由 TCPClient 提供的取消逻辑，stopWatch 停止对调用方 ctx 的监听
+	cancel    func(error)
+	stopWatch func() bool
 }
 
-func NewFuture() *Future {
-	c, _ := codec.New(codec.JSON)
+// NewFuture 创建一个用 t 对应的 codec 解码结果的 Future
+func NewFuture(t codec.Type) (*Future, error) {
+	cc, err := codec.New(t)
+	if err != nil {
+		return nil, err
+	}
 	return &Future{
-		done:  make(chan struct{}),
-		codec: c,
+		done:      make(chan struct{}),
+		codec:     cc,
+		codecType: t,
+	}, nil
+}
+
+// setCodec 响应声明的 codec 与请求不同时切换解码使用的 codec，需要在 Done 之前调用
+func (f *Future) setCodec(t codec.Type) {
+	if t == 0 || t == f.codecType {
+		return
+	}
+	if cc, err := codec.New(t); err == nil {
+		f.codec = cc
+		f.codecType = t
 	}
 }
 
@@ -29,13 +59,19 @@ func (f *Future) Done(res []byte, err error) {
 	f.mu.Lock()
 	f.res = res
 	f.err = err
+	f.completed = true
+	onComplete := f.onComplete
 	f.mu.Unlock()
 
-	if f.onComplete != nil {
-		f.onComplete(err)
+	if onComplete != nil {
+		onComplete(err)
 	}
 
 	close(f.done)
+
+	if f.stopWatch != nil {
+		f.stopWatch()
+	}
 }
 
 func (f *Future) Wait() ([]byte, error) {
@@ -45,8 +81,18 @@ func (f *Future) Wait() ([]byte, error) {
 	return f.res, f.err
 }
 
+// OnComplete 注册结果到达时的回调，响应可能在注册之前就已到达，此时立即执行
 func (f *Future) OnComplete(fn func(error)) {
-	f.onComplete = fn
+	f.mu.Lock()
+	if !f.completed {
+		f.onComplete = fn
+		f.mu.Unlock()
+		return
+	}
+	err := f.err
+	f.mu.Unlock()
+
+	fn(err)
 }
 
 func (f *Future) WaitWithContext(ctx context.Context) ([]byte, error) {
@@ -54,8 +100,21 @@ func (f *Future) WaitWithContext(ctx context.Context) ([]byte, error) {
 	case <-f.done:
 		return f.Wait()
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		if !f.abandon(ctx.Err()) {
+			return nil, status.FromContextError(ctx.Err())
+		}
+		// 取消与响应到达存在竞争，以最终的结果为准
+		return f.Wait()
+	}
+}
+
+// abandon 调用方不再等待：从 pending 中移除并通知服务端取消，请求以 ctx 的错误结束
+func (f *Future) abandon(err error) bool {
+	if f.cancel == nil {
+		return false
 	}
+	f.cancel(status.FromContextError(err))
+	return true
 }
 
 func (f *Future) DoneChan() <-chan struct{} {
@@ -71,7 +130,10 @@ func (f *Future) GetResult(reply interface{}) error {
 		return f.err
 	}
 
-	return f.codec.Unmarshal(f.res, reply)
+	if err := f.codec.Unmarshal(f.res, reply); err != nil {
+		return status.Wrap(status.Internal, err)
+	}
+	return nil
 }
 
 func (f *Future) GetResultWithContext(ctx context.Context, reply interface{}) error {
@@ -79,8 +141,19 @@ func (f *Future) GetResultWithContext(ctx context.Context, reply interface{}) er
 	case <-f.done:
 		return f.GetResult(reply)
 	case <-ctx.Done():
-		return ctx.Err()
+		if !f.abandon(ctx.Err()) {
+			return status.FromContextError(ctx.Err())
+		}
+		return f.GetResult(reply)
+	}
+}
+
+// Trailer 返回服务端随响应返回的元数据，调用完成前返回 nil
+func (f *Future) Trailer() metadata.MD {
+	if !f.IsDone() {
+		return nil
 	}
+	return f.trailer
 }
 
 func (f *Future) IsDone() bool {
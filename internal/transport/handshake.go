@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"fmt"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"slices"
+	"time"
+)
+
+// clientHandshake 客户端建连后立即发送握手帧，并同步等待服务端的协商结果。
+//
+// 握手帧按旧协议（VersionJSON）发送，并以 service 作为服务名：旧版本服务端不认识握手帧，
+// 会把它当作对 service 的普通调用并回复一个错误帧，此时返回 legacy 为 true，
+// 连接退回旧协议，即 JSON header、不做校验和、不发送心跳
+func clientHandshake(conn Conn, service string, local *protocol.Handshake, timeout time.Duration) (legacy bool, err error) {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// 协商完成前按旧协议收发
+	fallback := legacyHandshake(local)
+	conn.SetNegotiated(fallback)
+
+	err = conn.Write(&protocol.Message{
+		Header: &protocol.Header{Type: protocol.TypeHandshake, ServiceName: service},
+		Body:   local.Marshal(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("handshake: %w", err)
+	}
+
+	msg, err := conn.Read()
+	if err != nil {
+		return false, fmt.Errorf("handshake: %w", err)
+	}
+	if msg.Header.Type == protocol.TypeCall && msg.Header.RequestID == 0 && msg.Header.Err() != nil {
+		if len(fallback.Codecs) == 0 {
+			return false, fmt.Errorf("handshake: peer %s does not support handshake, codec %v requires it",
+				conn.RemoteAddr(), local.Codecs)
+		}
+		return true, nil
+	}
+	if msg.Header.Type != protocol.TypeHandshake {
+		return false, fmt.Errorf("handshake: unexpected frame type %d", msg.Header.Type)
+	}
+
+	var result protocol.Handshake
+	if err := result.Unmarshal(msg.Body); err != nil {
+		return false, fmt.Errorf("handshake: %w", err)
+	}
+	if result.Error != "" {
+		return false, fmt.Errorf("handshake rejected by %s: %s", conn.RemoteAddr(), result.Error)
+	}
+
+	// 服务端只能在客户端给出的范围内选择
+	if !slices.Contains(local.Versions, result.Version()) {
+		return false, fmt.Errorf("handshake: server chose unsupported protocol version %d", result.Version())
+	}
+	if len(result.Codecs) == 0 {
+		return false, fmt.Errorf("handshake: server returned no codec")
+	}
+	if result.Checksum && !local.Checksum {
+		return false, fmt.Errorf("handshake: server enabled checksum without request")
+	}
+
+	conn.SetNegotiated(&result)
+	return false, nil
+}
+
+// legacyHandshake 不支持握手的旧版本服务端隐含的能力：JSON header，只能解码 JSON 请求，
+// 只支持 gzip 压缩，没有校验和和心跳。本端不支持 JSON codec 时 Codecs 为空
+func legacyHandshake(local *protocol.Handshake) *protocol.Handshake {
+	hs := &protocol.Handshake{Versions: []protocol.Version{protocol.VersionJSON}}
+	if slices.Contains(local.Codecs, codec.JSON) {
+		hs.Codecs = []codec.Type{codec.JSON}
+	}
+	if slices.Contains(local.Compressions, codec.CompressionGzip) {
+		hs.Compressions = []codec.CompressionType{codec.CompressionGzip}
+	}
+	return hs
+}
+
+// AcceptHandshake 服务端处理客户端的握手帧并回复协商结果
+//
+// 协商失败时会先把原因回复给客户端再返回错误，调用方应随后关闭连接
+func AcceptHandshake(conn Conn, msg *protocol.Message, local *protocol.Handshake) error {
+	var remote protocol.Handshake
+	if err := remote.Unmarshal(msg.Body); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+
+	result, err := protocol.Negotiate(local, &remote)
+	if err != nil {
+		_ = conn.Write(&protocol.Message{
+			Header: &protocol.Header{Type: protocol.TypeHandshake},
+			Body:   (&protocol.Handshake{Error: err.Error()}).Marshal(),
+		})
+		return err
+	}
+
+	err = conn.Write(&protocol.Message{
+		Header: &protocol.Header{Type: protocol.TypeHandshake},
+		Body:   result.Marshal(),
+	})
+	if err != nil {
+		return err
+	}
+
+	conn.SetNegotiated(result)
+	return nil
+}
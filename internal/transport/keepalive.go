@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"errors"
+	"kamaRPC/internal/protocol"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrHeartbeatTimeout 超过 KeepaliveParams.Timeout 没有收到对端的任何帧
+	ErrHeartbeatTimeout = errors.New("heartbeat timeout")
+	// ErrIdleTimeout 连接空闲超过 KeepaliveParams.IdleTimeout
+	ErrIdleTimeout = errors.New("connection idle timeout")
+)
+
+// 默认 30 秒没有收到帧时发送心跳，90 秒（连续三次心跳）没有收到任何帧时关闭连接
+const (
+	DefaultKeepaliveInterval = 30 * time.Second
+	DefaultKeepaliveTimeout  = 90 * time.Second
+)
+
+// KeepaliveParams 连接的心跳和空闲检测参数，零值表示都不开启
+type KeepaliveParams struct {
+	// Interval 超过这么久没有收到任何帧时发送一个 ping，0 表示不发送
+	Interval time.Duration
+	// Timeout 超过这么久没有收到任何帧（包括 pong）时认为对端已经失联并关闭连接，0 表示不检测。
+	// 只在握手协商支持心跳时生效，避免误关闭不会回复 pong 的旧版本对端
+	Timeout time.Duration
+	// IdleTimeout 没有进行中的请求和流超过这么久时关闭连接，0 表示不关闭
+	IdleTimeout time.Duration
+}
+
+// Validate 检查参数是否合法，客户端和服务端的选项共用
+func (p KeepaliveParams) Validate() error {
+	if p.Interval < 0 || p.Timeout < 0 {
+		return errors.New("keepalive interval and timeout must not be negative")
+	}
+	if p.Interval > 0 && p.Timeout > 0 && p.Timeout <= p.Interval {
+		return errors.New("keepalive timeout must be greater than interval")
+	}
+	if p.IdleTimeout < 0 {
+		return errors.New("idle timeout must not be negative")
+	}
+	return nil
+}
+
+// tick 检查的周期，取各项时间中最短的一半
+func (p KeepaliveParams) tick() time.Duration {
+	var tick time.Duration
+	for _, d := range []time.Duration{p.Interval, p.Timeout, p.IdleTimeout} {
+		if d > 0 && (tick == 0 || d < tick) {
+			tick = d
+		}
+	}
+	return tick / 2
+}
+
+// Keepalive 记录一条连接的读取和请求活动，定期发送心跳并检测超时。
+//
+// 连接的读循环把收到的每一帧交给 Received，心跳帧在这里处理掉，不会进入请求的分发流程
+type Keepalive struct {
+	conn   Conn
+	params KeepaliveParams
+
+	// 最近一次收到任意帧、最近一次有请求活动的时间（UnixNano）
+	lastRead   atomic.Int64
+	lastActive atomic.Int64
+}
+
+func NewKeepalive(conn Conn, params KeepaliveParams) *Keepalive {
+	k := &Keepalive{conn: conn, params: params}
+	now := time.Now().UnixNano()
+	k.lastRead.Store(now)
+	k.lastActive.Store(now)
+	return k
+}
+
+// Received 记录收到了一帧，心跳帧返回 true，调用方不需要再处理。
+// 收到 ping 时在新的 goroutine 中回复 pong，不阻塞读循环
+func (k *Keepalive) Received(msg *protocol.Message) bool {
+	now := time.Now().UnixNano()
+	k.lastRead.Store(now)
+
+	switch msg.Header.Type {
+	case protocol.TypePing:
+		pong := &protocol.Message{
+			Header: &protocol.Header{Type: protocol.TypePong, RequestID: msg.Header.RequestID},
+		}
+		go k.conn.Write(pong)
+		return true
+	case protocol.TypePong:
+		return true
+	}
+
+	k.lastActive.Store(now)
+	return false
+}
+
+// Active 记录一次请求活动，例如发出了请求
+func (k *Keepalive) Active() {
+	k.lastActive.Store(time.Now().UnixNano())
+}
+
+// Run 定期发送心跳并检测超时，直到 done 被关闭时返回 nil，检测到超时返回对应的错误，
+// 由调用方关闭连接。busy 报告连接上是否还有进行中的请求或流，有时不算空闲
+func (k *Keepalive) Run(done <-chan struct{}, busy func() bool) error {
+	tick := k.params.tick()
+	if tick <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var lastPing time.Time
+	for {
+		select {
+		case <-done:
+			return nil
+		case now := <-ticker.C:
+			hs := k.conn.Negotiated()
+			heartbeat := hs != nil && hs.Heartbeat
+			sinceRead := now.Sub(time.Unix(0, k.lastRead.Load()))
+
+			if heartbeat && k.params.Timeout > 0 && sinceRead > k.params.Timeout {
+				return ErrHeartbeatTimeout
+			}
+
+			// 长时间执行的请求和流结束后重新开始计算空闲时间
+			if busy() {
+				k.lastActive.Store(now.UnixNano())
+			} else if k.params.IdleTimeout > 0 && now.Sub(time.Unix(0, k.lastActive.Load())) > k.params.IdleTimeout {
+				return ErrIdleTimeout
+			}
+
+			// 最近收到过帧说明连接是通的，不需要额外发送 ping
+			if heartbeat && k.params.Interval > 0 && sinceRead >= k.params.Interval && now.Sub(lastPing) >= k.params.Interval {
+				lastPing = now
+				go k.conn.Write(&protocol.Message{
+					Header: &protocol.Header{Type: protocol.TypePing},
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 内存地址的前缀，例如 mem://arith。
+//
+// 服务端在 mem:// 地址上监听，同一进程内的客户端按同一个地址拨号，
+// 两端通过带缓冲的内存管道通信，不占用端口也不经过网络，适合单元测试和进程内的服务
+const memScheme = "mem://"
+
+// memPipeSize 每个方向最多缓冲的字节数，写满后 Write 阻塞直到对端读取
+const memPipeSize = 1 << 20
+
+var (
+	memMu        sync.Mutex
+	memListeners = make(map[string]*memListener)
+)
+
+// memAddr 内存连接的地址
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return memScheme + string(a) }
+
+// listenMem 在 name 上监听，同一个名字同时只能有一个监听器
+func listenMem(name string) (net.Listener, error) {
+	memMu.Lock()
+	defer memMu.Unlock()
+
+	if _, ok := memListeners[name]; ok {
+		return nil, fmt.Errorf("%s%s is already in use", memScheme, name)
+	}
+	ln := &memListener{
+		name:  name,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	memListeners[name] = ln
+	return ln, nil
+}
+
+// dialMem 连接 name 上的监听器，ctx 结束前没有被 Accept 时返回错误
+func dialMem(ctx context.Context, name string) (net.Conn, error) {
+	memMu.Lock()
+	ln := memListeners[name]
+	memMu.Unlock()
+	if ln == nil {
+		return nil, fmt.Errorf("dial %s%s: connection refused", memScheme, name)
+	}
+
+	client, server := memPipe(memAddr(name))
+
+	select {
+	case ln.conns <- server:
+		return client, nil
+	case <-ln.done:
+		return nil, fmt.Errorf("dial %s%s: connection refused", memScheme, name)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("dial %s%s: %w", memScheme, name, ctx.Err())
+	}
+}
+
+type memListener struct {
+	name  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (ln *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ln.conns:
+		return conn, nil
+	case <-ln.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 停止监听并释放名字，已经建立的连接不受影响
+func (ln *memListener) Close() error {
+	ln.once.Do(func() {
+		close(ln.done)
+
+		memMu.Lock()
+		if memListeners[ln.name] == ln {
+			delete(memListeners, ln.name)
+		}
+		memMu.Unlock()
+	})
+	return nil
+}
+
+func (ln *memListener) Addr() net.Addr {
+	return memAddr(ln.name)
+}
+
+// memPipe 创建一对相连的内存连接，一端写入的数据从另一端读出
+func memPipe(addr memAddr) (net.Conn, net.Conn) {
+	a, b := newMemBuffer(), newMemBuffer()
+	return newMemConn(a, b, addr), newMemConn(b, a, addr)
+}
+
+// memBuffer 单向的环形字节缓冲，容量为 memPipeSize
+type memBuffer struct {
+	mu sync.Mutex
+	// 第一次写入时分配，空闲连接不占用缓冲区
+	data        []byte
+	start, size int
+	// 写端已关闭，读完剩余数据后返回 io.EOF
+	wclosed bool
+	// 读端已关闭，之后的写入返回错误
+	rclosed bool
+	// 数据或状态变化时关闭并替换，唤醒所有等待的读写
+	changed chan struct{}
+}
+
+func newMemBuffer() *memBuffer {
+	return &memBuffer{changed: make(chan struct{})}
+}
+
+func (b *memBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// read 读出已缓冲的数据，没有数据时返回等待的 chan
+func (b *memBuffer) read(p []byte) (int, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size > 0 {
+		n := copy(p, b.data[b.start:min(b.start+b.size, len(b.data))])
+		if n < len(p) && n < b.size {
+			n += copy(p[n:], b.data[:b.size-n])
+		}
+		b.start = (b.start + n) % len(b.data)
+		b.size -= n
+		b.notify()
+		return n, nil, nil
+	}
+	if b.wclosed {
+		return 0, nil, io.EOF
+	}
+	return 0, b.changed, nil
+}
+
+// write 写入缓冲区放得下的部分，缓冲区已满时返回等待的 chan
+func (b *memBuffer) write(p []byte) (int, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rclosed || b.wclosed {
+		return 0, nil, io.ErrClosedPipe
+	}
+	if b.data == nil {
+		b.data = make([]byte, memPipeSize)
+	}
+	if b.size == len(b.data) {
+		return 0, b.changed, nil
+	}
+
+	end := (b.start + b.size) % len(b.data)
+	n := copy(b.data[end:min(end+len(b.data)-b.size, len(b.data))], p)
+	if n < len(p) && b.size+n < len(b.data) {
+		n += copy(b.data[:len(b.data)-b.size-n], p[n:])
+	}
+	b.size += n
+	b.notify()
+	return n, nil, nil
+}
+
+func (b *memBuffer) closeRead() {
+	b.mu.Lock()
+	b.rclosed = true
+	b.data = nil
+	b.start, b.size = 0, 0
+	b.notify()
+	b.mu.Unlock()
+}
+
+func (b *memBuffer) closeWrite() {
+	b.mu.Lock()
+	b.wclosed = true
+	b.notify()
+	b.mu.Unlock()
+}
+
+// memConn 内存管道的一端，实现了 net.Conn 包括读写的截止时间
+type memConn struct {
+	r, w *memBuffer
+	addr memAddr
+
+	readDeadline  memDeadline
+	writeDeadline memDeadline
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemConn(r, w *memBuffer, addr memAddr) *memConn {
+	c := &memConn{
+		r:    r,
+		w:    w,
+		addr: addr,
+		done: make(chan struct{}),
+	}
+	c.readDeadline.cancel = make(chan struct{})
+	c.writeDeadline.cancel = make(chan struct{})
+	return c
+}
+
+func (c *memConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		select {
+		case <-c.done:
+			return 0, net.ErrClosed
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		default:
+		}
+
+		n, wait, err := c.r.read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+
+		select {
+		case <-wait:
+		case <-c.done:
+			return 0, net.ErrClosed
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *memConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		select {
+		case <-c.done:
+			return written, net.ErrClosed
+		case <-c.writeDeadline.wait():
+			return written, os.ErrDeadlineExceeded
+		default:
+		}
+
+		n, wait, err := c.w.write(p)
+		written += n
+		p = p[n:]
+		if err != nil {
+			return written, err
+		}
+		if n > 0 {
+			continue
+		}
+
+		select {
+		case <-wait:
+		case <-c.done:
+			return written, net.ErrClosed
+		case <-c.writeDeadline.wait():
+			return written, os.ErrDeadlineExceeded
+		}
+	}
+	return written, nil
+}
+
+// Close 关闭本端，对端读完已缓冲的数据后读到 io.EOF，之后对端的写入返回错误
+func (c *memConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.w.closeWrite()
+		c.r.closeRead()
+	})
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.addr }
+func (c *memConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// memDeadline 到期时关闭 cancel，等待中的读写随之返回
+type memDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// set 设置截止时间，零值表示没有截止时间
+func (d *memDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 定时器已经触发时等它关闭 cancel，避免之后重复关闭
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel
+	}
+	d.timer = nil
+
+	expired := isClosed(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+func (d *memDeadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemBufferWrap(t *testing.T) {
+	b := newMemBuffer()
+
+	// 每次写入和读出的长度不同，起点不断后移，多次绕过缓冲区的末尾
+	var want, got []byte
+	chunk := make([]byte, memPipeSize/3+7)
+	p := make([]byte, memPipeSize/4+3)
+	for i := 0; i < 20; i++ {
+		for j := range chunk {
+			chunk[j] = byte(i*31 + j)
+		}
+		data := chunk
+		for len(data) > 0 {
+			n, wait, err := b.write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				if wait == nil {
+					t.Fatal("full buffer returned no wait channel")
+				}
+				// 缓冲区已满，读出一部分腾出空间
+				m, _, err := b.read(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, p[:m]...)
+				continue
+			}
+			want = append(want, data[:n]...)
+			data = data[n:]
+		}
+	}
+
+	b.closeWrite()
+	for {
+		n, _, err := b.read(p)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p[:n]...)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("read %d bytes, wrote %d, contents differ", len(got), len(want))
+	}
+}
+
+func TestMemConnDeadline(t *testing.T) {
+	client, server := memPipe(memAddr("deadline"))
+	defer client.Close()
+	defer server.Close()
+
+	p := make([]byte, 16)
+
+	// 已经过去的截止时间立即生效
+	server.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, err := server.Read(p); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("past deadline: %v", err)
+	}
+
+	// 到期前阻塞，到期后返回
+	start := time.Now()
+	server.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := server.Read(p); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("future deadline: %v", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("read returned after %v, before the deadline", d)
+	}
+
+	// 到期前延长截止时间，之前的定时器不再生效
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	server.SetReadDeadline(time.Now().Add(time.Hour))
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		client.Write([]byte("ping"))
+	}()
+	if n, err := server.Read(p); err != nil || string(p[:n]) != "ping" {
+		t.Fatalf("extended deadline: %q %v", p[:n], err)
+	}
+
+	// 清除截止时间后恢复正常读写
+	server.SetReadDeadline(time.Now().Add(-time.Second))
+	server.SetReadDeadline(time.Time{})
+	client.Write([]byte("pong"))
+	if n, err := server.Read(p); err != nil || string(p[:n]) != "pong" {
+		t.Fatalf("cleared deadline: %q %v", p[:n], err)
+	}
+
+	// 写满缓冲区后写入阻塞，直到截止时间
+	client.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	n, err := client.Write(make([]byte, memPipeSize+1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) || n != memPipeSize {
+		t.Fatalf("write to full pipe: n=%d err=%v", n, err)
+	}
+}
+
+func TestMemConnClose(t *testing.T) {
+	client, server := memPipe(memAddr("close"))
+
+	client.Write([]byte("bye"))
+	client.Close()
+
+	// 对端先读完已缓冲的数据，再读到 EOF
+	p := make([]byte, 16)
+	if n, err := server.Read(p); err != nil || string(p[:n]) != "bye" {
+		t.Fatalf("buffered data: %q %v", p[:n], err)
+	}
+	if _, err := server.Read(p); err != io.EOF {
+		t.Fatalf("after close: %v", err)
+	}
+	if _, err := server.Write([]byte("x")); err == nil {
+		t.Fatal("write to closed peer succeeded")
+	}
+	if _, err := client.Read(p); err == nil {
+		t.Fatal("read on closed conn succeeded")
+	}
+	server.Close()
+}
+
+func TestMemListener(t *testing.T) {
+	ln, err := Listen("mem://listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("mem://listener"); err == nil {
+		t.Fatal("listened twice on the same name")
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	conn, err := Dial(context.Background(), "mem://listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("read %q %v", got, err)
+	}
+	conn.Close()
+
+	// 关闭后释放名字，新的拨号被拒绝
+	ln.Close()
+	if _, err := Dial(context.Background(), "mem://listener"); err == nil {
+		t.Fatal("dial after close succeeded")
+	}
+	ln2, err := Listen("mem://listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln2.Close()
+}
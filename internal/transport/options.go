@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+)
+
+// Options 客户端建立连接时使用的参数
+type Options struct {
+	// Service 握手帧中携带的服务名，需要是服务端注册过的服务。
+	// 旧版本服务端把握手帧当作对该服务的普通调用并回复错误，客户端据此退回旧协议
+	Service string
+	// Codecs 按偏好顺序列出本端支持的 codec，握手时发给服务端
+	Codecs []codec.Type
+	// Compressions 按偏好顺序列出本端支持的压缩算法
+	Compressions []codec.CompressionType
+	// CompressMinSize 小于该大小的 body 不压缩，0 表示总是按 header 压缩
+	CompressMinSize int
+	// Limits 限制服务端发来的帧大小，零值使用默认限制
+	Limits protocol.Limits
+	// Checksum 请求服务端对每一帧做 CRC32 校验
+	Checksum bool
+	// OnFrameError 收到非法帧（包括校验和不一致）并关闭连接时调用，可以为 nil
+	OnFrameError func(err error)
+	// Dialer 建立底层连接，为 nil 时使用 NetDialer，TLS 使用 TLSDialer
+	Dialer Dialer
+	// Keepalive 心跳和空闲检测参数，零值表示不开启
+	Keepalive KeepaliveParams
+}
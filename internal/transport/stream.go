@@ -0,0 +1,296 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/metadata"
+	"kamaRPC/status"
+	"sync"
+)
+
+var ErrStreamClosed = errors.New("stream closed")
+
+// 每个流最多缓冲的未读消息数和字节数。对端发送得比 Recv 处理得快、超过任一限制时，
+// 以 ResourceExhausted 结束流并通知对端，避免无限占用内存。队列为空时总能放下一条消息
+const (
+	StreamQueueSize  = 1024
+	StreamQueueBytes = 32 << 20
+)
+
+// Stream 复用在一条连接上的消息流，流 ID 即打开流时的 RequestID
+//
+// 同一时刻只允许一个 goroutine 调用 Send，一个 goroutine 调用 Recv
+type Stream struct {
+	id          uint64
+	conn        Conn
+	codec       codec.Codec
+	compression codec.CompressionType
+	streams     *Streams
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	queue    [][]byte
+	queued   int   // queue 中消息的总字节数
+	recvErr  error // 接收方向结束的原因，io.EOF 表示对端正常结束发送
+	sendDone bool  // 本端已半关闭或流已结束
+	done     bool  // 流已结束
+	trailer  metadata.MD
+	notify   chan struct{}
+}
+
+func newStream(ctx context.Context, cancel context.CancelFunc, id uint64, conn Conn,
+	cc codec.Codec, compression codec.CompressionType, streams *Streams) *Stream {
+
+	return &Stream{
+		id:          id,
+		conn:        conn,
+		codec:       cc,
+		compression: compression,
+		streams:     streams,
+		ctx:         ctx,
+		cancel:      cancel,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Context 流的上下文，流结束后被取消
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Send 发送一条消息
+func (s *Stream) Send(v interface{}) error {
+	s.mu.Lock()
+	sendDone := s.sendDone
+	s.mu.Unlock()
+	if sendDone {
+		return ErrStreamClosed
+	}
+
+	body, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(protocol.TypeStreamData, body, nil, nil)
+}
+
+// Recv 阻塞接收一条消息，对端结束发送后返回 io.EOF，流出错或 ctx 超时时返回对应的错误
+func (s *Stream) Recv(v interface{}) error {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			data := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.queued -= len(data)
+			s.mu.Unlock()
+			return s.codec.Unmarshal(data, v)
+		}
+		err := s.recvErr
+		s.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.ctx.Done():
+			// 流结束时 ctx 同样会被取消，此时回到循环开头读完剩余消息
+			s.mu.Lock()
+			done := s.done
+			s.mu.Unlock()
+			if !done {
+				return status.FromContextError(s.ctx.Err())
+			}
+		}
+	}
+}
+
+// CloseSend 半关闭，告诉对端本端不再发送消息
+func (s *Stream) CloseSend() error {
+	s.mu.Lock()
+	if s.sendDone {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sendDone = true
+	s.mu.Unlock()
+
+	return s.write(protocol.TypeStreamHalfClose, nil, nil, nil)
+}
+
+// Close 正常结束整个流，客户端调用时相当于放弃这次流式调用
+func (s *Stream) Close() error {
+	return s.Finish(nil, nil)
+}
+
+// Finish 结束整个流并通知对端：err 为 nil 时发送 Close 帧，否则发送携带 err 的 Error 帧，
+// trailer 随结束帧一起发给对端
+func (s *Stream) Finish(err error, trailer metadata.MD) error {
+	typ := protocol.TypeStreamClose
+	if err != nil {
+		typ = protocol.TypeStreamError
+	}
+
+	if !s.finish(io.EOF) {
+		return nil
+	}
+	return s.write(typ, nil, err, trailer)
+}
+
+// Trailer 对端结束流时携带的元数据，流结束前返回 nil
+func (s *Stream) Trailer() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trailer
+}
+
+func (s *Stream) write(typ protocol.MessageType, body []byte, err error, md metadata.MD) error {
+	msg := &protocol.Message{
+		Header: &protocol.Header{
+			Type:        typ,
+			RequestID:   s.id,
+			Compression: s.compression,
+			Metadata:    md,
+		},
+		Body: body,
+	}
+	if err != nil {
+		msg.Header.SetError(err)
+	}
+	return s.conn.Write(msg)
+}
+
+// deliver 由连接的读循环调用，处理对端发来的流帧
+func (s *Stream) deliver(msg *protocol.Message) {
+	switch msg.Header.Type {
+	case protocol.TypeStreamData:
+		s.mu.Lock()
+		full := len(s.queue) > 0 &&
+			(len(s.queue) >= StreamQueueSize || s.queued+len(msg.Body) > StreamQueueBytes)
+		if s.recvErr == nil && !full {
+			s.queue = append(s.queue, msg.Body)
+			s.queued += len(msg.Body)
+		}
+		s.mu.Unlock()
+
+		if full {
+			// 在读循环之外通知对端，发送队列满时不阻塞连接上的其他请求
+			err := status.New(status.ResourceExhausted, "stream receive queue full")
+			if s.finish(err) {
+				go s.write(protocol.TypeStreamError, nil, err, nil)
+			}
+			return
+		}
+		s.wake()
+
+	case protocol.TypeStreamHalfClose:
+		s.mu.Lock()
+		if s.recvErr == nil {
+			s.recvErr = io.EOF
+		}
+		s.mu.Unlock()
+		s.wake()
+
+	case protocol.TypeStreamClose:
+		s.setTrailer(msg.Header.Metadata)
+		s.finish(io.EOF)
+
+	case protocol.TypeStreamError:
+		s.setTrailer(msg.Header.Metadata)
+		s.finish(msg.Header.Err())
+	}
+}
+
+func (s *Stream) setTrailer(md metadata.MD) {
+	s.mu.Lock()
+	s.trailer = md
+	s.mu.Unlock()
+}
+
+// finish 在本地结束流：之后的 Send 失败，Recv 读完已收到的消息后返回 err，
+// 流从所属连接的流表中移除。返回 false 表示流之前已经结束
+func (s *Stream) finish(err error) bool {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return false
+	}
+	s.done = true
+	s.sendDone = true
+	if s.recvErr == nil || s.recvErr == io.EOF {
+		s.recvErr = err
+	}
+	s.mu.Unlock()
+
+	s.streams.remove(s.id)
+	s.cancel()
+	s.wake()
+	return true
+}
+
+func (s *Stream) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Streams 一条连接上的流表，按流 ID 分发对端发来的流帧
+type Streams struct {
+	m sync.Map // map[uint64]*Stream
+}
+
+// Accept 服务端收到 TypeStreamOpen 后创建并登记对应的流，流上的消息使用 cc 编码、compression 压缩
+func (ss *Streams) Accept(ctx context.Context, conn Conn, msg *protocol.Message,
+	cc codec.Codec, compression codec.CompressionType) *Stream {
+	var cancel context.CancelFunc
+	if msg.Header.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, msg.Header.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	s := newStream(ctx, cancel, msg.Header.RequestID, conn, cc, compression, ss)
+	ss.m.Store(s.id, s)
+	return s
+}
+
+func (ss *Streams) add(s *Stream) {
+	ss.m.Store(s.id, s)
+}
+
+func (ss *Streams) remove(id uint64) {
+	ss.m.Delete(id)
+}
+
+// Empty 判断连接上是否没有进行中的流
+func (ss *Streams) Empty() bool {
+	empty := true
+	ss.m.Range(func(key, value interface{}) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
+
+// Dispatch 把流帧交给对应的流，流不存在（已结束）时丢弃
+func (ss *Streams) Dispatch(msg *protocol.Message) {
+	if val, ok := ss.m.Load(msg.Header.RequestID); ok {
+		val.(*Stream).deliver(msg)
+	}
+}
+
+// CloseAll 连接断开时以 err 结束所有的流
+func (ss *Streams) CloseAll(err error) {
+	ss.m.Range(func(key, value interface{}) bool {
+		value.(*Stream).finish(err)
+		return true
+	})
+}
@@ -1,77 +1,240 @@
 package transport
 
 import (
+	"context"
 	"errors"
+	"kamaRPC/codec"
 	"kamaRPC/internal/protocol"
-	"net"
+	"kamaRPC/status"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+var errConnClosed = status.New(status.Unavailable, "connection closed")
+
 type TCPClient struct {
-	conn *TCPConnection
+	conn Conn
 	addr string
 
-	writeMu sync.Mutex
-	seq     uint64
+	seq uint64
 
 	pending sync.Map // map[uint64]*Future
+	streams Streams
+
+	onFrameError func(err error)
+
+	// 服务端是不支持握手的旧版本，不能发送取消帧和流式调用的帧
+	legacy bool
 
+	ka *Keepalive
+	// 连接关闭时关闭，停止心跳
+	done   chan struct{}
 	closed int32
 }
 
-func newTCPClient(addr string) (*TCPClient, error) {
-	rawConn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+func newTCPClient(addr string, opts Options) (*TCPClient, error) {
+	var dialer Dialer = NetDialer{}
+	if opts.Dialer != nil {
+		dialer = opts.Dialer
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	rawConn, err := dialer.Dial(ctx, addr)
+	cancel()
 	if err != nil {
 		return nil, err
 	}
 
+	conn := NewTCPConnection(rawConn, opts.Limits)
+	conn.SetCompressMinSize(opts.CompressMinSize)
+
 	c := &TCPClient{
-		conn: NewTCPConnection(rawConn),
-		addr: addr,
+		conn:         conn,
+		addr:         addr,
+		onFrameError: opts.OnFrameError,
+		ka:           NewKeepalive(conn, opts.Keepalive),
+		done:         make(chan struct{}),
+	}
+
+	local := &protocol.Handshake{
+		Versions:     protocol.SupportedVersions,
+		Codecs:       opts.Codecs,
+		Compressions: opts.Compressions,
+		Checksum:     opts.Checksum,
+		Heartbeat:    true,
+	}
+	c.legacy, err = clientHandshake(c.conn, opts.Service, local, 5*time.Second)
+	if err != nil {
+		_ = c.conn.Close()
+		return nil, err
 	}
 
 	go c.readLoop()
+	go c.keepalive()
 	return c, nil
 }
 
+// keepalive 对端失联或连接空闲时关闭连接，所有等待中的请求以 Unavailable 结束
+func (c *TCPClient) keepalive() {
+	err := c.ka.Run(c.done, func() bool {
+		busy := false
+		c.pending.Range(func(key, value interface{}) bool {
+			busy = true
+			return false
+		})
+		return busy || !c.streams.Empty()
+	})
+	if err != nil {
+		c.fail(err)
+	}
+}
+
 func (c *TCPClient) nextSeq() uint64 {
 	return atomic.AddUint64(&c.seq, 1)
 }
 
-func (c *TCPClient) SendAsync(msg *protocol.Message) (*Future, error) {
+// SendAsync 发送请求，ctx 被取消时向服务端发送取消帧，future 以 ctx 的错误结束
+func (c *TCPClient) SendAsync(ctx context.Context, msg *protocol.Message) (*Future, error) {
 	if atomic.LoadInt32(&c.closed) == 1 {
-		return nil, errors.New("connection closed")
+		return nil, errConnClosed
+	}
+
+	// 请求没有声明 codec 时按 JSON 解码，与服务端的默认 codec 一致
+	codecType := msg.Header.CodecType
+	if codecType == 0 {
+		codecType = codec.JSON
+	}
+	future, err := NewFuture(codecType)
+	if err != nil {
+		return nil, status.Wrap(status.InvalidArgument, err)
 	}
 
 	seq := c.nextSeq()
 	msg.Header.RequestID = seq
 
-	future := NewFuture()
+	// 服务端不支持的压缩算法退化为不压缩
+	if !c.conn.Negotiated().HasCompression(msg.Header.Compression) {
+		msg.Header.Compression = codec.CompressionNone
+	}
+
+	future.cancel = func(err error) {
+		// 与 readLoop 竞争，只有一方能从 pending 中取走
+		if _, ok := c.pending.LoadAndDelete(seq); ok {
+			future.Done(nil, err)
+			c.sendCancel(seq)
+		}
+	}
+	future.stopWatch = context.AfterFunc(ctx, func() {
+		future.cancel(status.FromContextError(ctx.Err()))
+	})
 	c.pending.Store(seq, future)
+	c.ka.Active()
 
-	c.writeMu.Lock()
-	err := c.conn.Write(msg)
-	c.writeMu.Unlock()
+	err = c.conn.Write(msg)
 
 	if err != nil {
 		c.pending.Delete(seq)
+		future.stopWatch()
 		c.fail(err) // 关键：write 失败也要彻底杀死连接(解决之前连接bug)
-		return nil, err
+		return nil, status.Wrap(status.Unavailable, err)
 	}
 
 	return future, nil
 }
 
+// Send 发送单向请求，不登记 pending，也不等待响应
+func (c *TCPClient) Send(msg *protocol.Message) error {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return errConnClosed
+	}
+
+	msg.Header.RequestID = c.nextSeq()
+	msg.Header.OneWay = true
+	c.ka.Active()
+
+	if !c.conn.Negotiated().HasCompression(msg.Header.Compression) {
+		msg.Header.Compression = codec.CompressionNone
+	}
+
+	if err := c.conn.Write(msg); err != nil {
+		c.fail(err)
+		return status.Wrap(status.Unavailable, err)
+	}
+	return nil
+}
+
+func (c *TCPClient) sendCancel(seq uint64) {
+	// 旧版本服务端会把取消帧当作普通请求
+	if c.legacy || atomic.LoadInt32(&c.closed) == 1 {
+		return
+	}
+	_ = c.conn.Write(&protocol.Message{
+		Header: &protocol.Header{
+			Type:      protocol.TypeCancel,
+			RequestID: seq,
+		},
+	})
+}
+
+// OpenStream 发送 TypeStreamOpen 帧打开一个流，ctx 被取消时通知服务端结束该流
+func (c *TCPClient) OpenStream(ctx context.Context, msg *protocol.Message, cc codec.Codec) (*Stream, error) {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return nil, errConnClosed
+	}
+	if c.legacy {
+		return nil, status.New(status.Unimplemented, "server does not support streaming")
+	}
+
+	seq := c.nextSeq()
+	msg.Header.RequestID = seq
+	msg.Header.Type = protocol.TypeStreamOpen
+
+	if !c.conn.Negotiated().HasCompression(msg.Header.Compression) {
+		msg.Header.Compression = codec.CompressionNone
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream := newStream(ctx, cancel, seq, c.conn, cc, msg.Header.Compression, &c.streams)
+	c.streams.add(stream)
+	c.ka.Active()
+
+	if err := c.conn.Write(msg); err != nil {
+		c.fail(err)
+		return nil, status.Wrap(status.Unavailable, err)
+	}
+
+	// 流结束时 stream.ctx 同样会被取消，此时 finish 返回 false，不会重复通知
+	context.AfterFunc(stream.ctx, func() {
+		if stream.finish(status.FromContextError(stream.ctx.Err())) {
+			_ = stream.write(protocol.TypeStreamClose, nil, nil, nil)
+		}
+	})
+
+	return stream, nil
+}
+
 func (c *TCPClient) readLoop() {
 	for {
 		msg, err := c.conn.Read()
 		if err != nil {
+			var frameErr *protocol.FrameError
+			if errors.As(err, &frameErr) && c.onFrameError != nil {
+				c.onFrameError(err)
+			}
 			c.fail(err)
 			return
 		}
 
+		if c.ka.Received(msg) {
+			continue
+		}
+
+		if msg.Header.Type.IsStream() {
+			c.streams.Dispatch(msg)
+			continue
+		}
+
 		seq := msg.Header.RequestID
 
 		val, ok := c.pending.LoadAndDelete(seq)
@@ -80,9 +243,11 @@ func (c *TCPClient) readLoop() {
 		}
 
 		future := val.(*Future)
+		future.trailer = msg.Header.Metadata
+		future.setCodec(msg.Header.CodecType)
 
-		if msg.Header.Error != "" {
-			future.Done(nil, errors.New(msg.Header.Error))
+		if err := msg.Header.Err(); err != nil {
+			future.Done(nil, err)
 		} else {
 			future.Done(msg.Body, nil)
 		}
@@ -93,23 +258,28 @@ func (c *TCPClient) fail(err error) {
 	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		return
 	}
+	close(c.done)
+	if _, ok := status.FromError(err); !ok {
+		err = status.Wrap(status.Unavailable, err)
+	}
 
 	// 关闭底层连接
 	// log.Println("底层连接被关闭")
 	_ = c.conn.Close()
 
-	// 失败所有 pending
+	// 失败所有 pending，与 future.cancel 竞争，只有取走的一方能结束 future
 	c.pending.Range(func(key, value interface{}) bool {
-		future := value.(*Future)
-		future.Done(nil, err)
-		c.pending.Delete(key)
+		if v, ok := c.pending.LoadAndDelete(key); ok {
+			v.(*Future).Done(nil, err)
+		}
 		return true
 	})
+
+	c.streams.CloseAll(err)
 }
 
+// Close 关闭连接，等待中的请求和流都以 Unavailable 结束，可以重复调用
 func (c *TCPClient) Close() error {
-	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
-		return nil
-	}
-	return c.conn.Close()
+	c.fail(errConnClosed)
+	return nil
 }
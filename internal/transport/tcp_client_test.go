@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/status"
+)
+
+// silentServer 完成握手后只读取请求，从不回复
+func silentServer(t *testing.T, addr string) {
+	t.Helper()
+
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn := NewTCPConnection(raw, protocol.Limits{})
+				defer conn.Close()
+
+				local := &protocol.Handshake{
+					Versions: protocol.SupportedVersions,
+					Codecs:   []codec.Type{codec.JSON},
+				}
+				for {
+					msg, err := conn.Read()
+					if err != nil {
+						return
+					}
+					if msg.Header.Type == protocol.TypeHandshake {
+						AcceptHandshake(conn, msg, local)
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func TestTCPClientCloseFailsPending(t *testing.T) {
+	const addr = "mem://silent"
+	silentServer(t, addr)
+
+	c, err := newTCPClient(addr, Options{Service: "Silent", Codecs: []codec.Type{codec.JSON}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future, err := c.SendAsync(context.Background(), &protocol.Message{
+		Header: &protocol.Header{ServiceName: "Silent", MethodName: "Wait"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc, _ := codec.New(codec.JSON)
+	stream, err := c.OpenStream(context.Background(), &protocol.Message{
+		Header: &protocol.Header{ServiceName: "Silent", MethodName: "Watch"},
+	}, cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	// 没有 ctx 的等待也要在关闭后返回
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := future.Wait()
+		waitErr <- err
+	}()
+	recvErr := make(chan error, 1)
+	go func() {
+		var v interface{}
+		recvErr <- stream.Recv(&v)
+	}()
+
+	for name, errc := range map[string]chan error{"future": waitErr, "stream": recvErr} {
+		select {
+		case err := <-errc:
+			if got := status.CodeOf(err); got != status.Unavailable {
+				t.Fatalf("%s: code = %v (%v), want Unavailable", name, got, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s still waiting after Close", name)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
@@ -2,119 +2,210 @@ package transport
 
 import (
 	"bufio"
+	"crypto/tls"
 	"io"
+	"kamaRPC/codec"
 	"kamaRPC/internal/protocol"
+	"kamaRPC/peer"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const BufferSize = 4096
 
-// 包缓冲区（处理粘包）
-type PacketBuffer struct {
-	buf  []byte
-	lock sync.Mutex
-}
+// maxPooledFrame 超过该容量的帧缓冲区用完后不放回池中，避免偶发的大帧长期占用内存
+const maxPooledFrame = 1 << 20
 
-func (pb *PacketBuffer) Write(data []byte) {
-	pb.lock.Lock()
-	pb.buf = append(pb.buf, data...)
-	pb.lock.Unlock()
-}
+// framePool 复用读写帧的缓冲区。写出时 header、压缩后的 body 和校验和都直接编码进去，
+// 读取时整帧直接读入，body 被消息引用的缓冲区不会放回
+var framePool = sync.Pool{New: func() interface{} {
+	buf := make([]byte, 0, BufferSize)
+	return &buf
+}}
 
-func (pb *PacketBuffer) Read() []byte {
-	pb.lock.Lock()
-	defer pb.lock.Unlock()
+type TCPConnection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	limits protocol.Limits
+	// 对端的地址和 TLS 状态
+	peer *peer.Peer
+
+	// 读取帧只在一个 goroutine 中进行，prefix 复用于每一帧的前 10 个字节
+	prefix [10]byte
+	// 出现过非法帧后不再读取，之后的字节流已无法对齐
+	readErr error
+
+	// 写出帧使用的协议版本，跟随对端最近一次使用的版本，
+	// 这样新版本服务端也能正常回复旧版本客户端
+	version uint32
+
+	// 握手协商出的结果，未握手（旧版本对端）时为 nil
+	negotiated atomic.Pointer[protocol.Handshake]
+	// 协商开启校验和后，写出的帧都带 CRC32
+	checksum atomic.Bool
+
+	// 小于该大小的 body 不压缩
+	compressMin int
+
+	// 写出的帧由 writeLoop 统一写出，见 writer.go
+	sendq      chan *writeReq
+	closing    chan struct{}
+	writerDone chan struct{}
+	closeOnce  sync.Once
+	closeErr   error
+}
 
-	// 最小包头长度校验
-	if len(pb.buf) < 10 {
-		return nil
+// 创建连接，limits 限制对端发来的帧大小，零值使用默认限制。
+// TLS 连接需要先完成握手，否则拿不到对端的证书
+func NewTCPConnection(conn net.Conn, limits protocol.Limits) *TCPConnection {
+	p := &peer.Peer{Addr: conn.RemoteAddr()}
+	if tlsConn, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := tlsConn.ConnectionState()
+		p.TLS = &state
 	}
 
-	headerLen := int(protocol.DecodeHeaderLen(pb.buf[2:6]))
-	bodyLen := int(protocol.DecodeBodyLen(pb.buf[6:10]))
-	totalLen := 10 + headerLen + bodyLen
-
-	if len(pb.buf) < totalLen {
-		return nil
+	tc := &TCPConnection{
+		conn:       conn,
+		reader:     bufio.NewReaderSize(conn, BufferSize),
+		limits:     limits,
+		peer:       p,
+		version:    uint32(protocol.CurrentVersion),
+		sendq:      make(chan *writeReq, SendQueueSize),
+		closing:    make(chan struct{}),
+		writerDone: make(chan struct{}),
 	}
-
-	packet := make([]byte, totalLen)
-	copy(packet, pb.buf[:totalLen])
-
-	// 移动窗口
-	pb.buf = pb.buf[totalLen:]
-	return packet
+	go tc.writeLoop()
+	return tc
 }
 
-type TCPConnection struct {
-	conn   net.Conn
-	reader *bufio.Reader
-	buffer *PacketBuffer
+// Read 读取并解码一帧，同一时间只能有一个 goroutine 调用
+//
+// 先读出 10 字节的前缀并校验 Magic 和长度，再用 io.ReadFull 把整帧读进池化的缓冲区，
+// 中间不经过额外的缓冲和拷贝。帧不合法时返回 *protocol.FrameError，之后每次调用都返回同一个错误，
+// 调用方应关闭连接
+func (tc *TCPConnection) Read() (*protocol.Message, error) {
+	if tc.readErr != nil {
+		return nil, tc.readErr
+	}
 
-	writeMu sync.Mutex
-}
+	if _, err := io.ReadFull(tc.reader, tc.prefix[:]); err != nil {
+		return nil, err
+	}
+	if err := protocol.CheckPrefix(tc.prefix[:], tc.limits); err != nil {
+		tc.readErr = err
+		return nil, err
+	}
 
-// 创建连接
-func NewTCPConnection(conn net.Conn) *TCPConnection {
-	return &TCPConnection{
-		conn:   conn,
-		reader: bufio.NewReaderSize(conn, BufferSize),
-		buffer: &PacketBuffer{
-			buf: make([]byte, 0, BufferSize*2),
-		},
+	totalLen := protocol.FrameLen(tc.prefix[:])
+
+	// 池中的缓冲区不够大时放回去，为这一帧单独分配
+	bufp := framePool.Get().(*[]byte)
+	frame := *bufp
+	if cap(frame) < totalLen {
+		framePool.Put(bufp)
+		bufp = new([]byte)
+		frame = make([]byte, totalLen)
 	}
-}
+	frame = frame[:totalLen]
 
-func (tc *TCPConnection) Read() (*protocol.Message, error) {
-	for {
-		// 尝试从缓冲区取完整包
-		if packet := tc.buffer.Read(); packet != nil {
-			return protocol.Decode(packet)
+	copy(frame, tc.prefix[:])
+	if _, err := io.ReadFull(tc.reader, frame[10:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
+		return nil, err
+	}
 
-		tmp := make([]byte, BufferSize)
-		n, err := tc.reader.Read(tmp)
-		if err != nil {
-			if err == io.EOF {
-				return nil, err
-			}
-			return nil, err
-		}
+	msg, err := protocol.DecodeLimits(frame, tc.limits)
+	if err != nil {
+		tc.readErr = err
+		return nil, err
+	}
+	atomic.StoreUint32(&tc.version, uint32(protocol.DecodeVersion(tc.prefix[2:3])))
 
-		if n > 0 {
-			tc.buffer.Write(tmp[:n])
+	// 未压缩的 body 直接引用帧缓冲区，此时缓冲区归消息所有，不能放回池中；
+	// 缓冲区比帧大得多时把 body 拷贝出来，避免小消息长期占用大块内存
+	if msg.Header.Compression == codec.CompressionNone && len(msg.Body) > 0 {
+		if cap(frame) <= 2*totalLen {
+			return msg, nil
 		}
+		msg.Body = append([]byte(nil), msg.Body...)
+	}
+
+	if cap(frame) <= maxPooledFrame {
+		*bufp = frame[:0]
+		framePool.Put(bufp)
 	}
+	return msg, nil
 }
 
+// Write 编码一帧并交给 writeLoop 写出，返回时这一帧已经写入内核或者失败。
+// 可以被多个 goroutine 同时调用，发送队列满时阻塞
 func (tc *TCPConnection) Write(msg *protocol.Message) error {
-	data, err := protocol.Encode(msg)
+	if len(msg.Body) < tc.compressMin {
+		msg.Header.Compression = codec.CompressionNone
+	}
+
+	// 编码在调用方的 goroutine 中完成，多个请求可以并行编码
+	bufp := framePool.Get().(*[]byte)
+	data, err := protocol.AppendFrame((*bufp)[:0], msg, tc.Version(), tc.checksum.Load())
+	defer func() {
+		if cap(data) <= maxPooledFrame {
+			*bufp = data[:0]
+			framePool.Put(bufp)
+		}
+	}()
 	if err != nil {
 		return err
 	}
 
-	tc.writeMu.Lock()
-	defer tc.writeMu.Unlock()
+	return tc.enqueue(data)
+}
 
-	total := 0
-	for total < len(data) {
-		n, err := tc.conn.Write(data[total:])
-		if err != nil {
-			return err
-		}
-		total += n
-	}
+// SetCompressMinSize 设置压缩阈值，小于 n 字节的 body 不压缩，需要在开始读写之前调用
+func (tc *TCPConnection) SetCompressMinSize(n int) {
+	tc.compressMin = n
+}
 
-	return nil
+// Version 返回写出帧使用的协议版本
+func (tc *TCPConnection) Version() protocol.Version {
+	return protocol.Version(atomic.LoadUint32(&tc.version))
 }
 
-// 关闭连接
+// Negotiated 返回握手协商出的结果，对端没有握手时返回 nil
+func (tc *TCPConnection) Negotiated() *protocol.Handshake {
+	return tc.negotiated.Load()
+}
+
+// SetNegotiated 记录握手协商出的结果
+func (tc *TCPConnection) SetNegotiated(hs *protocol.Handshake) {
+	tc.negotiated.Store(hs)
+	atomic.StoreUint32(&tc.version, uint32(hs.Version()))
+	tc.checksum.Store(hs.Checksum)
+}
+
+// SetDeadline 设置底层连接的读写截止时间
+func (tc *TCPConnection) SetDeadline(t time.Time) error {
+	return tc.conn.SetDeadline(t)
+}
+
+// 关闭连接，可以重复调用，排队中还没写出的帧返回连接已关闭的错误
 func (tc *TCPConnection) Close() error {
-	if tcp, ok := tc.conn.(*net.TCPConn); ok {
-		tcp.SetLinger(0)
-	}
-	return tc.conn.Close()
+	tc.closeOnce.Do(func() {
+		close(tc.closing)
+		if tcp, ok := tc.conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		tc.closeErr = tc.conn.Close()
+	})
+	return tc.closeErr
+}
+
+// Peer 返回对端的地址和 TLS 状态
+func (tc *TCPConnection) Peer() *peer.Peer {
+	return tc.peer
 }
 
 func (tc *TCPConnection) RemoteAddr() string {
@@ -11,6 +11,7 @@ var ErrPoolClosed = errors.New("connection pool closed")
 
 type ConnectionPool struct {
 	addr string
+	opts Options
 
 	maxActive int
 
@@ -21,9 +22,10 @@ type ConnectionPool struct {
 	next   int
 }
 
-func NewConnectionPool(addr string, maxIdle, maxActive int) *ConnectionPool {
+func NewConnectionPool(addr string, maxIdle, maxActive int, opts Options) *ConnectionPool {
 	return &ConnectionPool{
 		addr:      addr,
+		opts:      opts,
 		maxActive: maxActive,
 		conns:     make([]*TCPClient, 0, maxActive),
 	}
@@ -39,7 +41,7 @@ func (p *ConnectionPool) Acquire(ctx context.Context) (*TCPClient, error) {
 
 	// 如果没满，直接创建
 	if len(p.conns) < p.maxActive {
-		conn, err := newTCPClient(p.addr)
+		conn, err := newTCPClient(p.addr, p.opts)
 		if err != nil {
 			return nil, err
 		}
@@ -65,7 +67,7 @@ func (p *ConnectionPool) Acquire(ctx context.Context) (*TCPClient, error) {
 	}
 
 	// 如果全死了，重新建
-	conn, err := newTCPClient(p.addr)
+	conn, err := newTCPClient(p.addr, p.opts)
 	if err != nil {
 		return nil, err
 	}
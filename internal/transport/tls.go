@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// HandshakeTimeout TLS 握手的超时时间，避免不发送数据的连接一直占用服务端的 goroutine
+const HandshakeTimeout = 5 * time.Second
+
+// TLSDialer 在 Dialer 建立的连接上完成客户端的 TLS 握手
+type TLSDialer struct {
+	// Dialer 建立底层连接，为 nil 时使用 NetDialer
+	Dialer Dialer
+	// Config 没有指定 ServerName 时使用地址中的主机名校验服务端证书，
+	// unix 域套接字和内存连接需要显式指定
+	Config *tls.Config
+}
+
+func (d *TLSDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	cfg := d.Config
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		network, address := ParseAddr(addr)
+		if network != "tcp" {
+			return nil, fmt.Errorf("tls: server name must be set for %s", addr)
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	var dialer Dialer = NetDialer{}
+	if d.Dialer != nil {
+		dialer = d.Dialer
+	}
+	rawConn, err := dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return conn, nil
+}
+
+// TLSListener 只接受 TLS 连接，握手在 ServerHandshake 中完成
+type TLSListener struct {
+	// Listener 监听底层连接，为 nil 时使用 NetListener
+	Listener Listener
+	Config   *tls.Config
+}
+
+func (l *TLSListener) Listen(addr string) (net.Listener, error) {
+	var listener Listener = NetListener{}
+	if l.Listener != nil {
+		listener = l.Listener
+	}
+	ln, err := listener.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, l.Config), nil
+}
+
+// ServerHandshake 完成服务端的 TLS 握手，不需要握手的连接直接返回 nil。
+// 需要在 NewTCPConnection 之前调用，这样连接上才能拿到对端的证书
+func ServerHandshake(conn net.Conn) error {
+	hc, ok := conn.(interface {
+		HandshakeContext(ctx context.Context) error
+	})
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	if err := hc.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"net"
+	"sync"
+)
+
+// SendQueueSize 每个连接的发送队列长度，队列满时 Write 阻塞，对写入方形成背压
+const SendQueueSize = 1024
+
+// maxBatchFrames 一次向量写最多合并的帧数，低于 Linux 的 IOV_MAX
+const maxBatchFrames = 256
+
+// writeReq 排队等待写出的一帧，errc 返回写出的结果
+type writeReq struct {
+	data []byte
+	errc chan error
+}
+
+var writeReqPool = sync.Pool{New: func() interface{} {
+	return &writeReq{errc: make(chan error, 1)}
+}}
+
+// enqueue 把编码好的帧放入发送队列并等待写出
+func (tc *TCPConnection) enqueue(data []byte) error {
+	req := writeReqPool.Get().(*writeReq)
+	req.data = data
+
+	select {
+	case tc.sendq <- req:
+	case <-tc.writerDone:
+		req.data = nil
+		writeReqPool.Put(req)
+		return errConnClosed
+	}
+
+	select {
+	case err := <-req.errc:
+		req.data = nil
+		writeReqPool.Put(req)
+		return err
+	case <-tc.writerDone:
+		// writeLoop 已经退出，req 可能还留在队列里或者 errc 中有结果，不能放回池中
+		return errConnClosed
+	}
+}
+
+// writeLoop 每个连接一个的写 goroutine，把队列中已经排队的帧合并成一次向量写（writev）。
+//
+// 队列一空就立即写出，不会为了凑批而等待，因此低负载时没有额外延迟；
+// 高并发时一次系统调用写出多帧。写失败后字节流已经无法对齐，直接关闭连接
+func (tc *TCPConnection) writeLoop() {
+	defer close(tc.writerDone)
+
+	batch := make([]*writeReq, 0, maxBatchFrames)
+	bufs := make(net.Buffers, 0, maxBatchFrames)
+
+	for {
+		select {
+		case req := <-tc.sendq:
+			batch = append(batch, req)
+		case <-tc.closing:
+			tc.drainQueue()
+			return
+		}
+
+	collect:
+		for len(batch) < maxBatchFrames {
+			select {
+			case req := <-tc.sendq:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+
+		bufs = bufs[:0]
+		for _, req := range batch {
+			bufs = append(bufs, req.data)
+		}
+		// WriteTo 会移动切片，传入副本以便复用 bufs 的底层数组
+		pending := bufs
+		_, err := pending.WriteTo(tc.conn)
+		if err != nil {
+			_ = tc.Close()
+		}
+
+		for i, req := range batch {
+			req.errc <- err
+			batch[i] = nil
+		}
+		batch = batch[:0]
+		clear(bufs)
+	}
+}
+
+// drainQueue 连接关闭时让还在排队的写入方返回
+func (tc *TCPConnection) drainQueue() {
+	for {
+		select {
+		case req := <-tc.sendq:
+			req.errc <- errConnClosed
+		default:
+			return
+		}
+	}
+}
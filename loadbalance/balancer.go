@@ -1,6 +1,6 @@
 package loadbalance
 
-import "kamaRPC/internal/registry"
+import "kamaRPC/registry"
 
 type LoadBalancer interface {
 	Select([]registry.Instance) registry.Instance
@@ -1,7 +1,7 @@
 package loadbalance
 
 import (
-	"kamaRPC/internal/registry"
+	"kamaRPC/registry"
 	"math/rand"
 	"sync"
 	"time"
@@ -0,0 +1,114 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MD 随请求/响应传递的元数据，例如鉴权 token、租户 ID、trace ID 等
+type MD map[string]string
+
+// New 根据 map 创建 MD
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md[k] = v
+	}
+	return md
+}
+
+// Pairs 根据 key, value, key, value... 创建 MD，参数个数必须为偶数
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic(fmt.Sprintf("metadata: Pairs got odd number of arguments: %d", len(kv)))
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+// Get 读取 key 对应的值
+func (md MD) Get(key string) string {
+	return md[key]
+}
+
+// Copy 返回 md 的副本
+func (md MD) Copy() MD {
+	return New(md)
+}
+
+// Join 合并多个 MD，后面的同名 key 覆盖前面的
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type outgoingKey struct{}
+type incomingKey struct{}
+type trailerKey struct{}
+
+// NewOutgoingContext 客户端把要发送的元数据附加到 ctx 上，会覆盖 ctx 中已有的出站元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext 在 ctx 已有的出站元数据上追加 key/value
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+// FromOutgoingContext 读取 ctx 上的出站元数据
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext 服务端把收到的元数据附加到 handler 的 ctx 上
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext handler 读取请求携带的元数据
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+type trailer struct {
+	mu sync.Mutex
+	md MD
+}
+
+// NewTrailerContext 返回可以通过 SetTrailer 写入响应元数据的 ctx，
+// 以及在 handler 返回后取出这些元数据的函数，供服务端框架使用
+func NewTrailerContext(ctx context.Context) (context.Context, func() MD) {
+	t := &trailer{}
+	get := func() MD {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.md
+	}
+	return context.WithValue(ctx, trailerKey{}, t), get
+}
+
+// SetTrailer handler 设置随响应返回给调用方的元数据，多次调用会合并
+func SetTrailer(ctx context.Context, md MD) error {
+	t, ok := ctx.Value(trailerKey{}).(*trailer)
+	if !ok {
+		return fmt.Errorf("metadata: no trailer in context")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.md = Join(t.md, md)
+	return nil
+}
@@ -0,0 +1,44 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Peer 发起请求的对端信息，服务端 handler 通过 FromContext 读取
+type Peer struct {
+	// Addr 对端地址
+	Addr net.Addr
+	// TLS 握手完成后的连接状态，明文连接为 nil
+	TLS *tls.ConnectionState
+}
+
+// Certificate 返回对端经过校验的证书，没有开启双向 TLS 或对端未提供证书时返回 nil。
+//
+// handler 可以按证书的 Subject 做鉴权，例如:
+//
+//	p, _ := peer.FromContext(ctx)
+//	if cert := p.Certificate(); cert == nil || cert.Subject.CommonName != "billing" {
+//		return status.New(status.PermissionDenied, "forbidden")
+//	}
+func (p *Peer) Certificate() *x509.Certificate {
+	if p == nil || p.TLS == nil || len(p.TLS.VerifiedChains) == 0 || len(p.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return p.TLS.VerifiedChains[0][0]
+}
+
+type peerKey struct{}
+
+// NewContext 服务端把对端信息附加到 handler 的 ctx 上
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// FromContext 读取 ctx 上的对端信息
+func FromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
@@ -11,6 +11,7 @@ import (
 )
 
 type Instance struct {
+	// Addr TCP 地址为 host:port，unix 域套接字为 unix:///path/to.sock，进程内的服务为 mem://name
 	Addr string
 }
 
@@ -0,0 +1,47 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+
+	"kamaRPC/client"
+	"kamaRPC/status"
+)
+
+// Slow 一直阻塞到请求被取消
+type Slow struct{}
+
+func (Slow) Wait(ctx context.Context, args *Empty, reply *Empty) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCancelDoesNotTripBreaker(t *testing.T) {
+	const addr = "mem://cancel"
+	startServer(t, addr, map[string]interface{}{"Slow": Slow{}, "Echo": Echo{}})
+
+	c, err := client.NewClient(nil, client.WithClientAddrs(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 超过一个统计窗口的调用全部由调用方取消
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		future, err := c.InvokeAsync(ctx, "Slow", "Wait", &Empty{})
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		cancel()
+		if _, err := future.Wait(); status.CodeOf(err) != status.Canceled {
+			t.Fatalf("call %d: %v, want Canceled", i, err)
+		}
+	}
+
+	// 服务端一直健康，熔断器不应打开
+	var reply EchoReply
+	if err := c.Invoke(context.Background(), "Echo", "Echo", &EchoArgs{Text: "hi"}, &reply); err != nil {
+		t.Fatalf("call after cancellations: %v", err)
+	}
+}
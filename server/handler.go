@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/internal/transport"
+	"kamaRPC/metadata"
+	"kamaRPC/peer"
+	"kamaRPC/status"
+	"log"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	streamType  = reflect.TypeOf((*Stream)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	rawType     = reflect.TypeOf((*[]byte)(nil))
+)
+
+// Stream 流式方法收到的流对象，签名为 func(stream *Stream) error
+//
+// 服务端流式：客户端 Send 一条请求后 CloseSend，handler Recv 后多次 Send
+// 客户端流式：handler 循环 Recv 直到 io.EOF，最后 Send 一条响应
+// 双向流式：双方各自 Send/Recv
+// handler 返回后流随之结束，返回的 error 会传给客户端的 Recv
+type Stream = transport.Stream
+
+type Handler struct {
+	// 请求没有声明 codec 时使用的默认 codec
+	codec     codec.Codec
+	codecType codec.Type
+}
+
+func NewHandler(s interface{}, opts ...HandleOption) (*Handler, error) {
+	h := &Handler{}
+
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.codec == nil {
+		return nil, fmt.Errorf("codec must not be nil")
+	}
+
+	return h, nil
+}
+
+// Process 执行一次请求并写回响应，ctx 携带请求的截止时间，调用方取消请求时 ctx 被取消
+func (h *Handler) Process(ctx context.Context, conn transport.Conn, msg *protocol.Message, server interface{}) {
+
+	// log.Println("调试: ", h.server, " ", msg.Header.ServiceName, " ", msg.Header.MethodName)
+
+	// 排队期间已经超时或被取消的请求不再执行
+	if err := ctx.Err(); err != nil {
+		if !msg.Header.OneWay {
+			h.writeError(conn, msg.Header, status.FromContextError(err), nil)
+		}
+		return
+	}
+
+	ctx = metadata.NewIncomingContext(ctx, msg.Header.Metadata)
+	ctx = peer.NewContext(ctx, conn.Peer())
+	ctx, trailer := metadata.NewTrailerContext(ctx)
+
+	// 按请求声明的 codec 解码请求、编码响应
+	codecType, cc, err := h.codecFor(msg.Header.CodecType)
+	if err != nil {
+		if msg.Header.OneWay {
+			log.Printf("one-way call %s.%s failed: %v", msg.Header.ServiceName, msg.Header.MethodName, err)
+		} else {
+			h.writeError(conn, msg.Header, err, nil)
+		}
+		return
+	}
+
+	result, err := h.invoke(
+		ctx,
+		cc,
+		server,
+		msg.Header.ServiceName,
+		msg.Header.MethodName,
+		msg.Body,
+	)
+
+	// 单向调用不回复响应，错误只能记录在服务端
+	if msg.Header.OneWay {
+		if err != nil {
+			log.Printf("one-way call %s.%s failed: %v", msg.Header.ServiceName, msg.Header.MethodName, err)
+		}
+		return
+	}
+
+	if err != nil {
+		h.writeError(conn, msg.Header, err, trailer())
+		return
+	}
+
+	var body []byte
+	if raw, ok := result.(*[]byte); ok {
+		// 原始字节的响应由方法自己按请求的 codec 编码好
+		body = *raw
+	} else if result != nil {
+		var marshalErr error
+		body, marshalErr = cc.Marshal(result)
+		if marshalErr != nil {
+			log.Println("marshal error:", marshalErr)
+			h.writeError(conn, msg.Header, status.Wrap(status.Internal, marshalErr), trailer())
+			return
+		}
+	}
+
+	resp := &protocol.Message{
+		Header: &protocol.Header{
+			RequestID:   msg.Header.RequestID,
+			CodecType:   codecType,
+			Compression: responseCompression(conn, msg.Header),
+			Metadata:    trailer(),
+		},
+		Body: body,
+	}
+
+	conn.Write(resp)
+}
+
+// writeError 把 err 转换成状态码返回，handler 返回的普通 error 为 status.Unknown
+func (h *Handler) writeError(conn transport.Conn, req *protocol.Header, err error, md metadata.MD) {
+	resp := &protocol.Message{
+		Header: &protocol.Header{
+			RequestID:   req.RequestID,
+			Compression: responseCompression(conn, req),
+			Metadata:    md,
+		},
+	}
+	resp.Header.SetError(err)
+	conn.Write(resp)
+}
+
+// responseCompression 响应沿用请求的压缩算法，请求没有压缩（例如 body 小于客户端的阈值）时
+// 使用握手协商出的首选算法，未握手的旧版本客户端不压缩。
+// body 小于服务端的压缩阈值时连接会在写出时改为不压缩
+func responseCompression(conn transport.Conn, req *protocol.Header) codec.CompressionType {
+	if req.Compression != codec.CompressionNone {
+		return req.Compression
+	}
+	if hs := conn.Negotiated(); hs != nil && len(hs.Compressions) > 0 {
+		return hs.Compressions[0]
+	}
+	return codec.CompressionNone
+}
+
+// ProcessStream 处理 TypeStreamOpen 帧，在新的 goroutine 中运行流式方法
+func (h *Handler) ProcessStream(conn transport.Conn, msg *protocol.Message, server interface{}, streams *transport.Streams) {
+	ctx := metadata.NewIncomingContext(context.Background(), msg.Header.Metadata)
+	ctx = peer.NewContext(ctx, conn.Peer())
+	ctx, trailer := metadata.NewTrailerContext(ctx)
+
+	_, cc, err := h.codecFor(msg.Header.CodecType)
+	if err != nil {
+		streams.Accept(ctx, conn, msg, h.codec, codec.CompressionNone).Finish(err, nil)
+		return
+	}
+
+	stream := streams.Accept(ctx, conn, msg, cc, responseCompression(conn, msg.Header))
+
+	method, err := h.streamMethod(server, msg.Header.ServiceName, msg.Header.MethodName)
+	if err != nil {
+		stream.Finish(err, nil)
+		return
+	}
+
+	go func() {
+		results := method.Call([]reflect.Value{reflect.ValueOf(stream)})
+
+		var err error
+		if errVal := results[0].Interface(); errVal != nil {
+			err = errVal.(error)
+		}
+		stream.Finish(err, trailer())
+	}()
+}
+
+func (h *Handler) streamMethod(service interface{}, serviceName, methodName string) (reflect.Value, error) {
+	if service == nil {
+		return reflect.Value{}, status.Errorf(status.Unimplemented, "service not found: %s", serviceName)
+	}
+
+	method := reflect.ValueOf(service).MethodByName(methodName)
+	if !method.IsValid() {
+		return reflect.Value{}, status.Errorf(status.Unimplemented, "method not found: %s.%s", serviceName, methodName)
+	}
+
+	methodType := method.Type()
+	if methodType.NumIn() != 1 || methodType.In(0) != streamType ||
+		methodType.NumOut() != 1 || !methodType.Out(0).Implements(errorType) {
+		return reflect.Value{}, status.Errorf(status.Unimplemented, "method is not a stream method: %s.%s", serviceName, methodName)
+	}
+	return method, nil
+}
+
+// codecFor 返回请求声明的 codec，旧版本客户端没有声明时使用默认 codec
+func (h *Handler) codecFor(t codec.Type) (codec.Type, codec.Codec, error) {
+	if t == 0 {
+		return h.codecType, h.codec, nil
+	}
+
+	cc, err := codec.New(t)
+	if err != nil {
+		return 0, nil, status.Wrap(status.InvalidArgument, err)
+	}
+	return t, cc, nil
+}
+
+func (h *Handler) invoke(ctx context.Context, cc codec.Codec, service interface{}, serviceName, methodName string, body []byte) (interface{}, error) {
+
+	if service == nil {
+		return nil, status.Errorf(status.Unimplemented, "service not found: %s", serviceName)
+	}
+
+	serviceValue := reflect.ValueOf(service)
+	method := serviceValue.MethodByName(methodName)
+	if !method.IsValid() {
+		return nil, status.Errorf(status.Unimplemented, "method not found: %s.%s", serviceName, methodName)
+	}
+
+	methodType := method.Type()
+	numIn := methodType.NumIn()
+	numOut := methodType.NumOut()
+
+	args := make([]reflect.Value, 0, numIn)
+
+	// 第一个参数可以是 context.Context，用于读取元数据、设置 trailer
+	// req/reply 为 *[]byte 时不经过 codec，方法直接处理请求的原始 body，
+	// 并负责按请求声明的 codec 编码响应，用于代理和转发
+	offset := 0
+	if numIn == 3 && methodType.In(0) == contextType {
+		offset = 1
+		args = append(args, reflect.ValueOf(ctx))
+	}
+
+	// net/rpc 风格
+	// func(req *Req, reply *Resp) error
+	// func(ctx context.Context, req *Req, reply *Resp) error
+
+	if numIn == 2+offset &&
+		methodType.In(offset).Kind() == reflect.Ptr &&
+		methodType.In(offset+1).Kind() == reflect.Ptr &&
+		numOut == 1 &&
+		methodType.Out(0).Implements(errorType) {
+
+		// 构造 req
+		reqType := methodType.In(offset)
+		req := reflect.New(reqType.Elem())
+
+		if reqType == rawType {
+			req.Elem().SetBytes(body)
+		} else if len(body) > 0 {
+			if err := cc.Unmarshal(body, req.Interface()); err != nil {
+				return nil, status.Wrap(status.InvalidArgument, err)
+			}
+		}
+
+		// 构造 reply
+		replyType := methodType.In(offset + 1)
+		reply := reflect.New(replyType.Elem())
+
+		args = append(args, req)
+		args = append(args, reply)
+
+		results := method.Call(args)
+
+		// 处理 error
+		if errVal := results[0].Interface(); errVal != nil {
+			return nil, errVal.(error)
+		}
+
+		// 返回指针，proto.Message 只由指针类型实现
+		return reply.Interface(), nil
+	}
+	return nil, nil
+}
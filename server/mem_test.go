@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"kamaRPC/client"
+	"kamaRPC/codec"
+	"kamaRPC/metadata"
+)
+
+type EchoArgs struct {
+	Text string
+}
+
+type EchoReply struct {
+	Text string
+	// 请求中的 user 元数据
+	User string
+}
+
+// Echo 原样返回请求，并把请求的元数据放进响应和 trailer
+type Echo struct{}
+
+func (Echo) Echo(ctx context.Context, args *EchoArgs, reply *EchoReply) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	reply.Text = args.Text
+	reply.User = md.Get("user")
+	return metadata.SetTrailer(ctx, metadata.Pairs("echoed", fmt.Sprint(len(args.Text))))
+}
+
+func TestMemRoundTrip(t *testing.T) {
+	const addr = "mem://echo"
+	startServer(t, addr, map[string]interface{}{"Echo": Echo{}})
+
+	codecs := []codec.Type{codec.JSON, codec.MSGPACK}
+	compressions := []codec.CompressionType{
+		codec.CompressionNone,
+		codec.CompressionGzip,
+		codec.CompressionDeflate,
+		codec.CompressionZlib,
+		codec.CompressionSnappy,
+	}
+	// 最后一个大于内存管道的缓冲区，不压缩时写入和读取都会绕过环形缓冲区的末尾
+	sizes := []int{0, 100, 64 << 10, 3 << 19}
+
+	for _, ct := range codecs {
+		for _, comp := range compressions {
+			t.Run(fmt.Sprintf("codec%d/compression%d", ct, comp), func(t *testing.T) {
+				c, err := client.NewClient(nil,
+					client.WithClientAddrs(addr),
+					client.WithClientCodec(ct),
+					client.WithClientCompression(comp),
+					client.WithClientChecksum(),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer c.Close()
+
+				for _, n := range sizes {
+					ctx := metadata.AppendToOutgoingContext(context.Background(), "user", "alice")
+					args := &EchoArgs{Text: strings.Repeat("kama", n/4)}
+
+					var reply EchoReply
+					var trailer metadata.MD
+					if err := c.Invoke(ctx, "Echo", "Echo", args, &reply, client.WithCallTrailer(&trailer)); err != nil {
+						t.Fatalf("size %d: %v", n, err)
+					}
+					if reply.Text != args.Text {
+						t.Fatalf("size %d: reply text has %d bytes", n, len(reply.Text))
+					}
+					if reply.User != "alice" {
+						t.Fatalf("size %d: metadata user = %q", n, reply.User)
+					}
+					if got := trailer.Get("echoed"); got != fmt.Sprint(len(args.Text)) {
+						t.Fatalf("size %d: trailer echoed = %q", n, got)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"kamaRPC/codec"
+	"kamaRPC/internal/protocol"
+	"time"
+)
+
+type HandleOption func(*Handler) error
+
+// WithHandlerCodec 设置请求没有声明 codec 时使用的默认 codec
+func WithHandlerCodec(t codec.Type) HandleOption {
+	return func(c *Handler) error {
+		cc, err := codec.New(t)
+		if err != nil {
+			return err
+		}
+		c.codec = cc
+		c.codecType = t
+		return nil
+	}
+}
+
+type ServerOption func(*Server) error
+
+// WithServerCodec 设置默认 codec，用于没有在请求中声明 codec 的旧版本客户端，
+// 声明了 codec 的请求使用 codec 注册表中对应的实现
+func WithServerCodec(t codec.Type) ServerOption {
+	return func(c *Server) error {
+		cc, err := codec.New(t)
+		if err != nil {
+			return err
+		}
+		c.codec = cc
+		c.codecType = t
+		return nil
+	}
+}
+
+// WithServerMaxHeaderSize 限制客户端发来的帧的 header 大小，超过时关闭连接
+func WithServerMaxHeaderSize(n int) ServerOption {
+	return func(s *Server) error {
+		if n <= 0 || n > protocol.MaxHeaderLen {
+			return fmt.Errorf("max header size must be in (0, %d]", protocol.MaxHeaderLen)
+		}
+		s.limits.MaxHeaderSize = n
+		return nil
+	}
+}
+
+// WithServerMaxBodySize 限制客户端发来的帧的 body 大小（压缩前后都不能超过），超过时关闭连接
+func WithServerMaxBodySize(n int) ServerOption {
+	return func(s *Server) error {
+		if n <= 0 {
+			return fmt.Errorf("max body size must be positive")
+		}
+		s.limits.MaxBodySize = n
+		return nil
+	}
+}
+
+// WithServerChecksum 是否允许客户端开启 CRC32 校验，默认允许
+func WithServerChecksum(enabled bool) ServerOption {
+	return func(s *Server) error {
+		s.checksum = enabled
+		return nil
+	}
+}
+
+// WithServerCompressMinSize 只压缩不小于 n 字节的响应 body，0 表示总是压缩，
+// 默认为 codec.DefaultCompressMinSize
+func WithServerCompressMinSize(n int) ServerOption {
+	return func(s *Server) error {
+		if n < 0 {
+			return fmt.Errorf("compress min size must not be negative")
+		}
+		s.compressMin = n
+		return nil
+	}
+}
+
+// WithServerKeepalive 客户端连接超过 interval 没有发来任何帧时发送心跳，
+// 超过 timeout 没有发来任何帧时认为客户端已经失联并关闭连接，取消其上所有的请求和流。
+// 只对握手时声明支持心跳的客户端生效，0 表示不开启对应的功能，默认为 30 秒和 90 秒
+func WithServerKeepalive(interval, timeout time.Duration) ServerOption {
+	return func(s *Server) error {
+		p := s.keepalive
+		p.Interval = interval
+		p.Timeout = timeout
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		s.keepalive = p
+		return nil
+	}
+}
+
+// WithServerIdleTimeout 回收超过 d 没有进行中请求和流的客户端连接，0 表示不回收（默认）
+func WithServerIdleTimeout(d time.Duration) ServerOption {
+	return func(s *Server) error {
+		p := s.keepalive
+		p.IdleTimeout = d
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		s.keepalive = p
+		return nil
+	}
+}
+
+// WithServerListener 使用 l 监听底层连接，用于接入新的承载方式。
+// 同时设置了 TLS 时在 l 接受的连接上再做 TLS 握手
+func WithServerListener(l Listener) ServerOption {
+	return func(s *Server) error {
+		if l == nil {
+			return fmt.Errorf("listener must not be nil")
+		}
+		s.lis = l
+		return nil
+	}
+}
+
+// WithServerTLS 使用 cert 作为服务端证书，只接受 TLS 连接
+func WithServerTLS(cert tls.Certificate) ServerOption {
+	return func(s *Server) error {
+		cfg := s.tls()
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	}
+}
+
+// WithServerTLSFromFile 从 PEM 文件加载服务端证书和私钥，只接受 TLS 连接
+func WithServerTLSFromFile(certFile, keyFile string) ServerOption {
+	return func(s *Server) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		return WithServerTLS(cert)(s)
+	}
+}
+
+// WithServerClientCAs 开启双向 TLS，客户端必须提供由 pool 中 CA 签发的证书，
+// handler 可以通过 peer.FromContext 拿到校验过的客户端证书。需要同时设置服务端证书
+func WithServerClientCAs(pool *x509.CertPool) ServerOption {
+	return func(s *Server) error {
+		if pool == nil {
+			return fmt.Errorf("client CA pool must not be nil")
+		}
+		cfg := s.tls()
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		return nil
+	}
+}
+
+// WithServerTLSConfig 直接使用 cfg，用于证书热更新等需要完全控制 TLS 参数的场景
+func WithServerTLSConfig(cfg *tls.Config) ServerOption {
+	return func(s *Server) error {
+		if cfg == nil {
+			return fmt.Errorf("tls config must not be nil")
+		}
+		s.tlsConfig = cfg.Clone()
+		return nil
+	}
+}
+
+// tls 返回正在构造的 TLS 配置，第一次调用时创建
+func (s *Server) tls() *tls.Config {
+	if s.tlsConfig == nil {
+		s.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return s.tlsConfig
+}
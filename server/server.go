@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"kamaRPC/codec"
+	"kamaRPC/internal/limiter"
+	"kamaRPC/internal/protocol"
+	"kamaRPC/internal/transport"
+	"kamaRPC/status"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Listener 监听底层连接，用 WithServerListener 替换默认的 TCP/unix/mem 监听方式
+type Listener = transport.Listener
+
+type Server struct {
+	addr     string
+	services map[string]interface{}
+	limiter  *limiter.TokenBucket
+	listener net.Listener
+	handler  *Handler
+	codec    codec.Codec
+	// 请求没有声明 codec 时使用的默认 codec 类型
+	codecType codec.Type
+	// 客户端发来的帧的大小限制
+	limits protocol.Limits
+	// 小于该大小的 body 不压缩
+	compressMin int
+	// 是否允许客户端开启 CRC32 校验
+	checksum bool
+	// 校验和不一致而关闭的连接数
+	checksumErrors atomic.Uint64
+	// 不为 nil 时只接受 TLS 连接
+	tlsConfig *tls.Config
+	// 监听底层连接的方式，为 nil 时按地址的类型监听
+	lis Listener
+	// 心跳、读超时和空闲连接回收的参数
+	keepalive transport.KeepaliveParams
+
+	mu      sync.Mutex
+	conns   map[transport.Conn]struct{}
+	closing chan struct{}
+}
+
+// 这边用了另外一种go规范去创建对象
+func mustNewHandler(t codec.Type) *Handler {
+	h, err := NewHandler(nil, WithHandlerCodec(t))
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func NewServer(addr string, opts ...ServerOption) (*Server, error) {
+	s := &Server{
+		addr:      addr,
+		services:  make(map[string]interface{}),
+		limiter:   limiter.NewTokenBucket(10000),
+		codecType: codec.JSON,
+		checksum:  true,
+
+		compressMin: codec.DefaultCompressMinSize,
+		conns:       make(map[transport.Conn]struct{}),
+		closing:     make(chan struct{}),
+
+		keepalive: transport.KeepaliveParams{
+			Interval: transport.DefaultKeepaliveInterval,
+			Timeout:  transport.DefaultKeepaliveTimeout,
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.tlsConfig != nil && len(s.tlsConfig.Certificates) == 0 && s.tlsConfig.GetCertificate == nil {
+		return nil, errors.New("tls: server certificate not configured")
+	}
+
+	s.handler = mustNewHandler(s.codecType)
+	return s, nil
+}
+
+func (s *Server) Register(name string, service interface{}) {
+	s.services[name] = service
+}
+
+// 单连接多路复用模型，每个请求和流式方法都在各自的 goroutine 中执行，
+// 响应通过 RequestID 与请求对应，不要求按顺序返回。
+// 读循环只负责分发：流帧交给对应的流，取消帧取消对应请求的 ctx
+func (s *Server) Handle(conn transport.Conn) {
+	defer conn.Close()
+	log.Println("测试一次")
+
+	streams := &transport.Streams{}
+	calls := &sync.Map{} // map[uint64]context.CancelFunc，正在执行的请求
+
+	// 客户端失联或连接空闲时关闭连接，读循环随之退出
+	ka := transport.NewKeepalive(conn, s.keepalive)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		err := ka.Run(done, func() bool {
+			busy := false
+			calls.Range(func(key, value interface{}) bool {
+				busy = true
+				return false
+			})
+			return busy || !streams.Empty()
+		})
+		if err != nil {
+			log.Println("close connection:", conn.RemoteAddr(), err)
+			conn.Close()
+		}
+	}()
+
+	for {
+		// 读取请求
+		msg, err := conn.Read()
+		if err != nil {
+			var frameErr *protocol.FrameError
+			if errors.As(err, &frameErr) {
+				if errors.Is(err, protocol.ErrChecksumMismatch) {
+					s.checksumErrors.Add(1)
+				}
+				log.Println("close connection on bad frame:", conn.RemoteAddr(), err)
+			}
+
+			// 连接被关闭或出错，结束所有的流、取消所有的请求后退出
+			streams.CloseAll(err)
+			calls.Range(func(key, value interface{}) bool {
+				value.(context.CancelFunc)()
+				return true
+			})
+			return
+		}
+
+		if ka.Received(msg) {
+			continue
+		}
+
+		// 握手帧只在建连后出现一次，旧版本客户端不会发送
+		if msg.Header.Type == protocol.TypeHandshake {
+			if err := transport.AcceptHandshake(conn, msg, s.capabilities()); err != nil {
+				log.Println("handshake failed:", conn.RemoteAddr(), err)
+				return
+			}
+			continue
+		}
+
+		if msg.Header.Type.IsStream() && msg.Header.Type != protocol.TypeStreamOpen {
+			streams.Dispatch(msg)
+			continue
+		}
+
+		if msg.Header.Type == protocol.TypeCancel {
+			if val, ok := calls.Load(msg.Header.RequestID); ok {
+				val.(context.CancelFunc)()
+			}
+			continue
+		}
+
+		// 限流检查，被拒绝的单向调用直接丢弃
+		if !s.limiter.Allow() {
+			if msg.Header.OneWay {
+				continue
+			}
+			resp := &protocol.Message{
+				Header: &protocol.Header{
+					RequestID:   msg.Header.RequestID,
+					Compression: responseCompression(conn, msg.Header),
+				},
+			}
+			resp.Header.SetError(status.New(status.ResourceExhausted, "rate limit exceeded"))
+			if msg.Header.Type == protocol.TypeStreamOpen {
+				resp.Header.Type = protocol.TypeStreamError
+			}
+			conn.Write(resp)
+			continue
+		}
+		// 处理请求
+		if msg.Header.Type == protocol.TypeStreamOpen {
+			s.handler.ProcessStream(conn, msg, s.services[msg.Header.ServiceName], streams)
+			continue
+		}
+
+		ctx, cancel := requestContext(msg)
+		calls.Store(msg.Header.RequestID, cancel)
+
+		go func(service interface{}) {
+			defer func() {
+				calls.Delete(msg.Header.RequestID)
+				cancel()
+			}()
+			s.handler.Process(ctx, conn, msg, service)
+		}(s.services[msg.Header.ServiceName])
+	}
+}
+
+// requestContext 根据请求携带的剩余超时时间构造 handler 的 ctx，从收到请求时开始计时
+func requestContext(msg *protocol.Message) (context.Context, context.CancelFunc) {
+	if msg.Header.Timeout > 0 {
+		return context.WithTimeout(context.Background(), msg.Header.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// capabilities 握手时声明的服务端能力
+func (s *Server) capabilities() *protocol.Handshake {
+	return &protocol.Handshake{
+		Versions:     protocol.SupportedVersions,
+		Codecs:       codec.Types(),
+		Compressions: codec.Compressions(),
+		Checksum:     s.checksum,
+		Heartbeat:    true,
+	}
+}
+
+// ChecksumErrors 返回因为校验和不一致而关闭的连接数
+func (s *Server) ChecksumErrors() uint64 {
+	return s.checksumErrors.Load()
+}
+
+func (s *Server) Start() error {
+	var lis Listener = transport.NetListener{}
+	if s.lis != nil {
+		lis = s.lis
+	}
+	if s.tlsConfig != nil {
+		lis = &transport.TLSListener{Listener: lis, Config: s.tlsConfig}
+	}
+
+	ln, err := lis.Listen(s.addr)
+	if err != nil {
+		return err
+	}
+
+	// Start 通常在单独的 goroutine 中执行，可能与 Shutdown 同时发生
+	s.mu.Lock()
+	select {
+	case <-s.closing:
+		s.mu.Unlock()
+		return ln.Close()
+	default:
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.closing:
+				return nil
+			default:
+				continue
+			}
+		}
+
+		// TLS 握手在各自的 goroutine 中完成，慢速的客户端不会阻塞 Accept
+		go s.serveConn(conn)
+	}
+
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	if err := transport.ServerHandshake(conn); err != nil {
+		log.Println("close connection:", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	tcpConn := transport.NewTCPConnection(conn, s.limits)
+	tcpConn.SetCompressMinSize(s.compressMin)
+
+	// Shutdown 之后才登记的连接不会被它关闭
+	s.mu.Lock()
+	select {
+	case <-s.closing:
+		s.mu.Unlock()
+		tcpConn.Close()
+		return
+	default:
+	}
+	s.conns[tcpConn] = struct{}{}
+	s.mu.Unlock()
+
+	s.Handle(tcpConn)
+
+	s.mu.Lock()
+	delete(s.conns, tcpConn)
+	s.mu.Unlock()
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// Shutdown 停止监听并关闭所有连接，unix 域套接字的文件随监听器一起删除
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	close(s.closing)
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	log.Println("server shutdown complete")
+}
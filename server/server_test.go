@@ -0,0 +1,37 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+
+	"kamaRPC/internal/transport"
+	"kamaRPC/server"
+)
+
+// startServer 在 addr 上启动服务端，开始监听后返回，测试结束时关闭
+func startServer(t *testing.T, addr string, services map[string]interface{}, opts ...server.ServerOption) {
+	t.Helper()
+
+	ready := make(chan struct{})
+	listener := transport.ListenFunc(func(addr string) (net.Listener, error) {
+		defer close(ready)
+		return transport.Listen(addr)
+	})
+
+	s, err := server.NewServer(addr, append(opts, server.WithServerListener(listener))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, svc := range services {
+		s.Register(name, svc)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+	select {
+	case <-ready:
+	case err := <-errc:
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Shutdown)
+}
@@ -0,0 +1,158 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"kamaRPC/client"
+	"kamaRPC/peer"
+	"kamaRPC/server"
+	"kamaRPC/status"
+)
+
+// WhoAmI 返回调用方证书的 CommonName，只允许 alice 调用
+type WhoAmI struct{}
+
+type Empty struct{}
+
+func (WhoAmI) Name(ctx context.Context, args *Empty, reply *string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.New(status.Internal, "no peer in context")
+	}
+	cert := p.Certificate()
+	if cert == nil {
+		return status.New(status.Unauthenticated, "client certificate required")
+	}
+	if cert.Subject.CommonName != "alice" {
+		return status.New(status.PermissionDenied, "forbidden: "+cert.Subject.CommonName)
+	}
+	*reply = cert.Subject.CommonName
+	return nil
+}
+
+// issue 签发一张证书，parent 为 nil 时生成自签名的 CA
+func issue(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert, key
+}
+
+// TestMutualTLS 同时演示双向 TLS 的用法：用内存中的 CA 签发服务端和客户端证书，
+// handler 按客户端证书的 CommonName 鉴权
+func TestMutualTLS(t *testing.T) {
+	_, ca, caKey := issue(t, "kama-ca", nil, nil)
+	serverCert, _, _ := issue(t, "localhost", ca, caKey)
+	alice, _, _ := issue(t, "alice", ca, caKey)
+	bob, _, _ := issue(t, "bob", ca, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	const addr = "mem://tls-test"
+	startServer(t, addr, map[string]interface{}{"WhoAmI": WhoAmI{}},
+		server.WithServerTLS(serverCert),
+		server.WithServerClientCAs(pool),
+	)
+
+	call := func(opts ...client.ClientOption) (string, error) {
+		opts = append(opts,
+			client.WithClientAddrs(addr),
+			client.WithClientRootCAs(pool),
+			client.WithClientServerName("localhost"),
+		)
+		c, err := client.NewClient(nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		var reply string
+		err = c.Invoke(context.Background(), "WhoAmI", "Name", &Empty{}, &reply)
+		return reply, err
+	}
+
+	t.Run("CASignedClient", func(t *testing.T) {
+		reply, err := call(client.WithClientCertificate(alice))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// handler 通过 peer.FromContext 拿到了客户端证书的 Subject
+		if reply != "alice" {
+			t.Fatalf("reply = %q, want alice", reply)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := call(client.WithClientCertificate(bob))
+		if got := status.CodeOf(err); got != status.PermissionDenied {
+			t.Fatalf("code = %v (%v), want PermissionDenied", got, err)
+		}
+	})
+
+	t.Run("NoClientCertificate", func(t *testing.T) {
+		_, err := call()
+		if err == nil {
+			t.Fatal("call without client certificate succeeded")
+		}
+		if got := status.CodeOf(err); got != status.Unavailable {
+			t.Fatalf("code = %v (%v), want Unavailable", got, err)
+		}
+	})
+
+	t.Run("UntrustedServer", func(t *testing.T) {
+		c, err := client.NewClient(nil,
+			client.WithClientAddrs(addr),
+			client.WithClientServerName("localhost"),
+			client.WithClientCertificate(alice),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		var reply string
+		if err := c.Invoke(context.Background(), "WhoAmI", "Name", &Empty{}, &reply); err == nil {
+			t.Fatal("client accepted a server certificate from an unknown CA")
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Code RPC 状态码，含义与 gRPC 的 canonical codes 保持一致
+type Code uint32
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = [...]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// 只比较状态码的哨兵错误，用于 errors.Is(err, status.ErrNotFound)
+var (
+	ErrCanceled           = New(Canceled, "")
+	ErrUnknown            = New(Unknown, "")
+	ErrInvalidArgument    = New(InvalidArgument, "")
+	ErrDeadlineExceeded   = New(DeadlineExceeded, "")
+	ErrNotFound           = New(NotFound, "")
+	ErrAlreadyExists      = New(AlreadyExists, "")
+	ErrPermissionDenied   = New(PermissionDenied, "")
+	ErrResourceExhausted  = New(ResourceExhausted, "")
+	ErrFailedPrecondition = New(FailedPrecondition, "")
+	ErrAborted            = New(Aborted, "")
+	ErrOutOfRange         = New(OutOfRange, "")
+	ErrUnimplemented      = New(Unimplemented, "")
+	ErrInternal           = New(Internal, "")
+	ErrUnavailable        = New(Unavailable, "")
+	ErrDataLoss           = New(DataLoss, "")
+	ErrUnauthenticated    = New(Unauthenticated, "")
+)
+
+// Detail 错误附带的强类型详情，Value 为 JSON 编码
+type Detail struct {
+	Type  string
+	Value []byte
+}
+
+// NewDetail 把 v 编码成详情，Type 取 v 的完整类型名
+func NewDetail(v interface{}) (Detail, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Detail{}, err
+	}
+	return Detail{Type: typeName(v), Value: data}, nil
+}
+
+// Unmarshal 把详情解码到 v
+func (d Detail) Unmarshal(v interface{}) error {
+	return json.Unmarshal(d.Value, v)
+}
+
+// Error 携带状态码的 RPC 错误
+type Error struct {
+	code    Code
+	message string
+	details []Detail
+	cause   error
+}
+
+// New 创建状态错误
+func New(code Code, msg string) *Error {
+	return &Error{code: code, message: msg}
+}
+
+// Errorf 创建状态错误，message 按 format 格式化
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// Wrap 以 err 的内容创建状态错误，errors.Is/As 仍然可以匹配到 err
+func Wrap(code Code, err error) *Error {
+	return &Error{code: code, message: err.Error(), cause: err}
+}
+
+func (e *Error) Error() string {
+	if e.message == "" {
+		return e.code.String()
+	}
+	return e.code.String() + ": " + e.message
+}
+
+func (e *Error) Code() Code {
+	return e.code
+}
+
+func (e *Error) Message() string {
+	return e.message
+}
+
+func (e *Error) Details() []Detail {
+	return e.details
+}
+
+// WithDetails 返回附带了详情的副本
+func (e *Error) WithDetails(details ...Detail) *Error {
+	cp := *e
+	cp.details = append(append([]Detail(nil), e.details...), details...)
+	return &cp
+}
+
+// FindDetail 查找与 v 类型相同的详情并解码到 v，没有找到时返回 false
+func (e *Error) FindDetail(v interface{}) bool {
+	name := typeName(v)
+	for _, d := range e.details {
+		if d.Type == name {
+			return d.Unmarshal(v) == nil
+		}
+	}
+	return false
+}
+
+// Is 状态码相同即匹配，target 带有 message 时还要求 message 相同
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.code == t.code && (t.message == "" || e.message == t.message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// FromError 从 err 中取出状态错误
+func FromError(err error) (*Error, bool) {
+	var st *Error
+	if errors.As(err, &st) {
+		return st, true
+	}
+	return nil, false
+}
+
+// CodeOf 返回 err 对应的状态码，nil 为 OK，不是状态错误的为 Unknown
+func CodeOf(err error) Code {
+	return Convert(err).Code()
+}
+
+// Convert 把任意 error 转换成状态错误：
+// 状态错误原样返回，context 的错误转换为 Canceled/DeadlineExceeded，其余为 Unknown
+func Convert(err error) *Error {
+	if err == nil {
+		return New(OK, "")
+	}
+	if st, ok := FromError(err); ok {
+		return st
+	}
+	if st := FromContextError(err); st != nil {
+		return st
+	}
+	return Wrap(Unknown, err)
+}
+
+// FromContextError 把 context.Canceled/DeadlineExceeded 转换为对应的状态错误，其余返回 nil
+func FromContextError(err error) *Error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Wrap(DeadlineExceeded, err)
+	case errors.Is(err, context.Canceled):
+		return Wrap(Canceled, err)
+	}
+	return nil
+}
+
+func typeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}